@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,7 +17,7 @@ import (
 )
 
 // Replace the directory navigation code in main() with:
-func browseDirectory(dirID string) (string, error) {
+func browseDirectory(dirID string, states map[string]internal.EpisodeState) (string, error) {
     for {
         dir, err := internal.GetVadapav(dirID)
         if err != nil {
@@ -34,7 +36,7 @@ func browseDirectory(dirID string) (string, error) {
                 fileOptions[file.Id] = fmt.Sprintf("📁 %s", file.Name)
             } else if strings.HasSuffix(strings.ToLower(file.Name), ".mkv") || 
                       strings.HasSuffix(strings.ToLower(file.Name), ".mp4") {
-                fileOptions[file.Id] = fmt.Sprintf("🎬 %s", file.Name)
+                fileOptions[file.Id] = fmt.Sprintf("🎬 %s%s", states[file.Id].Marker(), file.Name)
             }
         }
 
@@ -67,10 +69,95 @@ func browseDirectory(dirID string) (string, error) {
     }
 }
 
+// Find renderers on the network and start url on the configured or selected one
+func startCast(url string, deviceName string) (internal.MediaPlayer, error) {
+	internal.OctoOut("Searching for renderers...")
+	renderers, err := internal.DiscoverRenderers(3 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if len(renderers) == 0 {
+		return nil, fmt.Errorf("no renderers found on the network")
+	}
+
+	options := make(map[string]string)
+	for _, renderer := range renderers {
+		if deviceName != "" && strings.EqualFold(renderer.Name, deviceName) {
+			return internal.NewDLNAPlayer(renderer, url)
+		}
+		options[renderer.Location] = renderer.Name
+	}
+
+	selected, err := internal.DynamicSelect(options)
+	if err != nil {
+		return nil, err
+	}
+	if selected.Key == "-1" {
+		internal.ExitOcto("", nil)
+	}
+	for _, renderer := range renderers {
+		if renderer.Location == selected.Key {
+			return internal.NewDLNAPlayer(renderer, url)
+		}
+	}
+	return nil, fmt.Errorf("renderer not found")
+}
+
+func newTracker(config *internal.OctoConfig) *internal.Tracker {
+	tokenFile := filepath.Join(os.ExpandEnv(config.StoragePath), "tracker_token.json")
+	return internal.NewTracker(config.TrackerURL, config.TrackerClientID, config.TrackerClientSecret, tokenFile)
+}
+
+// Ask which tracker show a show is, storing "none" if it shouldn't be scrobbled
+func mapTrackerShow(tracker *internal.Tracker, show *internal.TVShow) error {
+	showName, err := internal.GetShowNameFromID(show.ID)
+	if err != nil {
+		showName = show.ID
+	}
+	results, err := tracker.SearchShows(showName)
+	if err != nil {
+		return err
+	}
+
+	internal.OctoOut(fmt.Sprintf("Which tracker show is %s?", showName))
+	options := map[string]string{"none": "Don't scrobble this show"}
+	for _, result := range results {
+		options[strconv.Itoa(result.IDs.Trakt)] = fmt.Sprintf("%s (%d)", result.Title, result.Year)
+	}
+	selected, err := internal.DynamicSelect(options)
+	if err != nil {
+		return err
+	}
+	if selected.Key == "-1" {
+		// Ask again next time
+		return nil
+	}
+	show.TrackerID = selected.Key
+	return nil
+}
+
+// Open a file in the user's editor and wait for it to close
+func openEditor(path string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		} else {
+			editor = "vim"
+		}
+	}
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
 
 func main() {
 	var user internal.User
 	var show internal.TVShow
+	var showDetails *internal.Show
+	autoAdvance := true
 	vadapavPlaybackUrl := "https://dl2.vadapav.mov/f/"
 
     var homeDir string
@@ -97,14 +184,30 @@ func main() {
 	flag.StringVar(&userOctoConfig.Player, "player", userOctoConfig.Player, "Player to use for playback (Only mpv supported currently)")
 	flag.StringVar(&userOctoConfig.StoragePath, "storage-path", userOctoConfig.StoragePath, "Path to the storage directory")
 	flag.IntVar(&userOctoConfig.PercentageToMarkComplete, "percentage-to-mark-complete", userOctoConfig.PercentageToMarkComplete, "Percentage to mark episode as complete")
-	flag.BoolVar(&userOctoConfig.SaveMpvSpeed, "save-mpv-speed", userOctoConfig.SaveMpvSpeed, "Save MPV speed setting (true/false)")
+	flag.BoolVar(&userOctoConfig.SaveMpvSpeed, "save-mpv-speed", userOctoConfig.SaveMpvSpeed, "Remember the playback speed per show (true/false)")
 	flag.BoolVar(&userOctoConfig.NextEpisodePrompt, "next-episode-prompt", userOctoConfig.NextEpisodePrompt, "Prompt for the next episode (true/false)")
+	flag.BoolVar(&userOctoConfig.SkipIntro, "skip-intro", userOctoConfig.SkipIntro, "Skip intros using chapters or recorded markers (true/false)")
+	flag.BoolVar(&userOctoConfig.AudioOnly, "audio-only", userOctoConfig.AudioOnly, "Play sound only, controlled from the terminal (true/false)")
+	flag.IntVar(&userOctoConfig.MaxEpisodesPerSession, "max-episodes", userOctoConfig.MaxEpisodesPerSession, "Stop auto-advancing after this many episodes (0 = no limit)")
+	flag.IntVar(&userOctoConfig.StillWatchingAfter, "still-watching-after", userOctoConfig.StillWatchingAfter, "Pause and ask \"Are you still watching?\" after this many auto-advanced episodes (0 = never)")
+	flag.BoolVar(&userOctoConfig.SkipOutro, "skip-outro", userOctoConfig.SkipOutro, "Skip outros using chapters or recorded markers (true/false)")
 
 	// Boolean flags that accept true/false
 	rofiSelection := flag.Bool("rofi", false, "Open selection in rofi")
 	editConfig := flag.Bool("e", false, "Edit config file")
+	editShowConfig := flag.Bool("edit-show", false, "Edit per-show settings for the selected show")
 	noRofi := flag.Bool("no-rofi", false, "No rofi")
 	updateScript := flag.Bool("update", false, "Update the script")
+	castEpisode := flag.Bool("cast", false, "Cast to a DLNA/UPnP renderer on the network instead of playing in mpv")
+	printURL := flag.Bool("print-url", false, "Print the playback URL of the selected episode and exit")
+	flag.StringVar(&userOctoConfig.ExternalPlayerCommand, "external-player", userOctoConfig.ExternalPlayerCommand, "Play with this command instead of mpv, {url} is replaced with the episode URL")
+	sleepTimer := flag.Duration("sleep", 0, "Stop playback after this long, e.g. 45m")
+	flag.StringVar(&userOctoConfig.ControlAddress, "control", userOctoConfig.ControlAddress, "Serve the HTTP control API on this address, e.g. 127.0.0.1:8787 or unix:/tmp/octopus.sock")
+	trackerLogin := flag.Bool("tracker-login", false, "Log in to the scrobbling tracker")
+	trackerRemap := flag.Bool("tracker-remap", false, "Choose again which tracker show the selected show is")
+	partyHost := flag.String("party-host", "", "Host a watch party on this address, e.g. :7777")
+	partyJoin := flag.String("party-join", "", "Join the watch party at this address, e.g. 192.168.1.10:7777")
+	showHistory := flag.Bool("history", false, "Pick an episode to watch again from the watch history")
 
 	// Custom help/usage function
 	flag.Usage = func() {
@@ -115,6 +218,29 @@ func main() {
 	}
 
 	flag.Parse()
+	internal.HandleSignals()
+
+	// Config keys given on the command line, re-applied over the per-show settings
+	flagConfigKeys := map[string]string{
+		"player":                      "Player",
+		"storage-path":                "StoragePath",
+		"percentage-to-mark-complete": "PercentageToMarkComplete",
+		"save-mpv-speed":              "SaveMpvSpeed",
+		"next-episode-prompt":         "NextEpisodePrompt",
+		"skip-intro":                  "SkipIntro",
+		"audio-only":                  "AudioOnly",
+		"max-episodes":                "MaxEpisodesPerSession",
+		"still-watching-after":        "StillWatchingAfter",
+		"skip-outro":                  "SkipOutro",
+		"external-player":             "ExternalPlayerCommand",
+		"control":                     "ControlAddress",
+	}
+	flagOverrides := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if key, ok := flagConfigKeys[f.Name]; ok {
+			flagOverrides[key] = f.Value.String()
+		}
+	})
 
 	if *updateScript {
 		repo := "wraient/octo"
@@ -127,20 +253,21 @@ func main() {
 		}
 	}
 
+	if *trackerLogin {
+		if userOctoConfig.TrackerClientID == "" {
+			internal.ExitOcto("", fmt.Errorf("set TrackerClientID and TrackerClientSecret in the config first"))
+		}
+		err := newTracker(&userOctoConfig).Login(func(verificationURL string, userCode string) {
+			fmt.Printf("Open %s and enter the code %s\n", verificationURL, userCode)
+		})
+		if err != nil {
+			internal.ExitOcto("", err)
+		}
+		internal.ExitOcto("Logged in to the tracker!", nil)
+	}
+
     if *editConfig {
-        editor := os.Getenv("EDITOR")
-        if editor == "" {
-            if runtime.GOOS == "windows" {
-                editor = "notepad"
-            } else {
-                editor = "vim" 
-            }
-        }
-        cmd := exec.Command(editor, os.ExpandEnv(configFilePath))
-        cmd.Stdin = os.Stdin
-        cmd.Stdout = os.Stdout
-        cmd.Stderr = os.Stderr
-        if err := cmd.Run(); err != nil {
+        if err := openEditor(os.ExpandEnv(configFilePath)); err != nil {
             fmt.Printf("Error opening editor: %v\n", err)
         }
         internal.Log(fmt.Sprintf("Editing config file: %s", os.ExpandEnv(configFilePath)), logFile)
@@ -154,6 +281,9 @@ func main() {
 	if *noRofi || runtime.GOOS == "windows" {
 		userOctoConfig.RofiSelection = false
 	}
+	if *rofiSelection || *noRofi || runtime.GOOS == "windows" {
+		flagOverrides["RofiSelection"] = strconv.FormatBool(userOctoConfig.RofiSelection)
+	}
 
     // Download Rofi config's if not already present
 	if userOctoConfig.RofiSelection {
@@ -176,11 +306,78 @@ func main() {
 	internal.ClearLog(logFile)
 	// Get all shows from database
 	shows := internal.LocalGetAllShows(databaseFile)
-	
-	if len(shows) > 0 {
+
+	// Participants play whatever the party host is watching
+	var party *internal.Party
+	if *partyJoin != "" {
+		party, err = internal.JoinParty(*partyJoin)
+		if err != nil {
+			internal.ExitOcto("", err)
+		}
+		internal.OctoOut(fmt.Sprintf("Joined watch party at %s, waiting for the host", *partyJoin))
+		state, err := party.WaitForState(30 * time.Second)
+		if err != nil {
+			internal.ExitOcto("", err)
+		}
+		show = internal.TVShow{ID: state.ShowID, EpisodeID: state.EpisodeID, PlaybackTime: int(state.Position + 0.5)}
+		for _, s := range shows {
+			if s.ID == show.ID {
+				show.SkipMarkers, show.AudioTrack, show.SubtitleTrack = s.SkipMarkers, s.AudioTrack, s.SubtitleTrack
+				break
+			}
+		}
+		user.Resume = show.PlaybackTime > 0
+	}
+
+	if *showHistory && show.ID == "" {
+		entries, err := internal.LocalGetHistory(databaseFile, 200)
+		if err != nil {
+			internal.ExitOcto("", err)
+		}
+		if len(entries) == 0 {
+			internal.ExitOcto("Nothing in the watch history yet", nil)
+		}
+
+		// Most recent first, details are fetched once per show
+		details := make(map[string]*internal.Show)
+		var options []internal.SelectionOption
+		for i, entry := range entries {
+			if _, ok := details[entry.ShowID]; !ok {
+				details[entry.ShowID], _ = internal.GetShow(entry.ShowID)
+			}
+			options = append(options, internal.SelectionOption{Label: internal.HistoryLabel(entry, details[entry.ShowID]), Key: strconv.Itoa(i)})
+		}
+
+		selected, err := internal.OrderedSelect(options)
+		if err != nil {
+			internal.Log(fmt.Sprintf("Error selecting from history: %v", err), logFile)
+			return
+		}
+		index, err := strconv.Atoi(selected.Key)
+		if err != nil || index < 0 {
+			internal.ExitOcto("", nil)
+		}
+
+		// Play the episode again from where that stretch ended, keeping the show's saved settings
+		entry := entries[index]
+		show = internal.TVShow{ID: entry.ShowID}
+		if s := internal.LocalFindShow(shows, entry.ShowID); s != nil {
+			show = *s
+		}
+		show.EpisodeID = entry.EpisodeID
+		show.PlaybackTime = 0
+		if !entry.Completed {
+			show.PlaybackTime = entry.EndPosition
+			show.LastWatched = entry.EndedAt
+		}
+		user.Resume = show.PlaybackTime > 0
+	}
+
+	if len(shows) > 0 && show.ID == "" {
 		// Create options for continue watching prompt
 		continueOptions := map[string]string{
 			"y": "Continue watching",
+			"b": "Continue watching from the start of the episode",
 			"n": "Search for a new show",
 		}
 
@@ -194,19 +391,22 @@ func main() {
             internal.ExitOcto("", nil)
         }
 
-		if selectedOption.Key == "y" {
-			// Create options map for database shows
-			options := make(map[string]string)
+		if selectedOption.Key == "y" || selectedOption.Key == "b" {
+			// Most recently watched shows first
+			sort.SliceStable(shows, func(i, j int) bool {
+				return shows[i].LastWatched > shows[j].LastWatched
+			})
+			var options []internal.SelectionOption
 			for _, s := range shows {
 				showName, err := internal.GetShowNameFromID(s.ID)
 				if err != nil {
 					showName = s.ID
 				}
-				options[s.ID] = fmt.Sprintf("%s (Episode ID: %s)", showName, s.EpisodeID)
+				options = append(options, internal.SelectionOption{Label: fmt.Sprintf("%s (Episode ID: %s)", showName, s.EpisodeID), Key: s.ID})
 			}
 
 			// Show selection menu
-			selectedShow, err := internal.DynamicSelect(options)
+			selectedShow, err := internal.OrderedSelect(options)
 			if err != nil {
 				internal.Log(fmt.Sprintf("Error selecting show: %v", err), logFile)
 				return
@@ -220,7 +420,10 @@ func main() {
 			for _, s := range shows {
 				if s.ID == selectedShow.Key {
 					show = s
-					user.Resume = true
+					user.Resume = selectedOption.Key == "y" && s.PlaybackTime > 0
+					if !user.Resume {
+						show.PlaybackTime = 0
+					}
 					break
 				}
 			}
@@ -240,7 +443,7 @@ func main() {
             }
         } else {
             reader := bufio.NewReader(os.Stdin)
-            fmt.Print("Enter name: ")
+            fmt.Fprint(os.Stderr, "Enter name: ")
             query, _ = reader.ReadString('\n')
             query = strings.TrimSpace(query)
         }
@@ -263,7 +466,8 @@ func main() {
 		}
 
 		// Replace the directory navigation section with a recursive approach
-		selectedEpisodeID, err := browseDirectory(selectedShow.Key)
+		states := internal.LocalGetEpisodeStates(databaseFile, selectedShow.Key)
+		selectedEpisodeID, err := browseDirectory(selectedShow.Key, states)
 		if err != nil {
 			internal.Log(fmt.Sprintf("Error browsing directory: %v", err), logFile)
 			internal.ExitOcto("", err)
@@ -275,136 +479,790 @@ func main() {
 			EpisodeID:    selectedEpisodeID,
 			PlaybackTime: 0,
 		}
+		// Pick up an episode left partway through
+		if state := states[selectedEpisodeID]; state.InProgress() {
+			show.PlaybackTime = state.Position
+			show.LastWatched = state.LastWatched
+			user.Resume = true
+		}
 	}
 
-    internal.OctoOut(fmt.Sprintf("Playing %s", show.EpisodeID))
-	// Start MPV with show data
-	user.Player.SocketPath, err = internal.PlayWithMPV(fmt.Sprintf("%s%s", vadapavPlaybackUrl, show.EpisodeID))
+	if *editShowConfig {
+		showName, err := internal.GetShowNameFromID(show.ID)
+		if err != nil {
+			showName = show.ID
+		}
+		showConfigPath, err := internal.CreateShowConfig(configFilePath, show.ID, showName)
+		if err != nil {
+			internal.ExitOcto("", err)
+		}
+		if err := openEditor(showConfigPath); err != nil {
+			fmt.Printf("Error opening editor: %v\n", err)
+		}
+		internal.ExitOcto("Show settings updated!", nil)
+	}
+
+	// Per-show settings override the global ones for this playback session, flags override both
+	globalOctoConfig := userOctoConfig
+	userOctoConfig, err = internal.LoadShowConfig(configFilePath, show.ID, globalOctoConfig, flagOverrides)
 	if err != nil {
-		internal.Log(fmt.Sprintf("Error starting MPV: %v", err), logFile)
+		internal.Log(fmt.Sprintf("Error loading show config: %v", err), logFile)
+	}
+
+	// Scrobble to the tracker once the show is matched to a tracker show
+	var scrobbler *internal.Scrobbler
+	if userOctoConfig.Scrobble {
+		tracker := newTracker(&userOctoConfig)
+		if !tracker.LoggedIn() {
+			internal.OctoOut("Not logged in to the tracker, run octopus -tracker-login")
+		} else {
+			if show.TrackerID == "" || *trackerRemap {
+				if err := mapTrackerShow(tracker, &show); err != nil {
+					internal.Log(fmt.Sprintf("Error matching show on the tracker: %v", err), logFile)
+				}
+			}
+			scrobbler = internal.NewScrobbler(tracker, filepath.Join(os.ExpandEnv(userOctoConfig.StoragePath), "tracker_queue.json"), logFile)
+			scrobbler.SetMapping(show.ID, show.TrackerID)
+			internal.Subscribe(scrobbler.Handle)
+			internal.OnExit(scrobbler.Wait)
+		}
+	}
+
+	// Hand the episode off to another tool instead of mpv
+	if *printURL || userOctoConfig.ExternalPlayerCommand != "" {
+		if userOctoConfig.ExternalPlayerRecord {
+			if err := internal.LocalUpdateShow(databaseFile, show); err != nil {
+				internal.Log(fmt.Sprintf("Error updating database: %v", err), logFile)
+			}
+		}
+		if *printURL {
+			fmt.Println(vadapavPlaybackUrl + show.EpisodeID)
+			os.Exit(0)
+		}
+		internal.OctoOut(fmt.Sprintf("Playing %s with %s", show.EpisodeID, userOctoConfig.ExternalPlayerCommand))
+		if err := internal.PlayWithExternal(userOctoConfig.ExternalPlayerCommand, vadapavPlaybackUrl+show.EpisodeID); err != nil {
+			internal.Log(fmt.Sprintf("Error starting external player: %v", err), logFile)
+			internal.ExitOcto("", err)
+		}
+		internal.ExitOcto("", nil)
+	}
+
+	internal.OctoOut(fmt.Sprintf("Playing %s", show.EpisodeID))
+	// Start MPV with show data, resuming a little before where we stopped
+	var mpvArgs []string
+	if user.Resume {
+		// A party participant starts where the host is, not rewound
+		if *partyJoin == "" {
+			show.PlaybackTime = internal.ResumePosition(show.PlaybackTime, show.LastWatched, &userOctoConfig)
+		}
+		mpvArgs = append(mpvArgs, fmt.Sprintf("--start=%d", show.PlaybackTime))
+	}
+	// Restore the speed this show was last watched at
+	if userOctoConfig.SaveMpvSpeed && show.Speed > 0 {
+		mpvArgs = append(mpvArgs, fmt.Sprintf("--speed=%g", show.Speed))
+	}
+	if *partyHost != "" {
+		party, err = internal.HostParty(*partyHost)
+		if err != nil {
+			internal.ExitOcto("", err)
+		}
+		internal.OctoOut(fmt.Sprintf("Hosting watch party on %s", *partyHost))
+	}
+	var partySync *internal.PartySync
+	if party != nil {
+		partySync = &internal.PartySync{Party: party}
+	}
+
+	// Run the user's hook scripts on playback events
+	hooks := internal.NewHookRunner(os.ExpandEnv(userOctoConfig.HooksDir), time.Duration(userOctoConfig.HookTimeout)*time.Second, logFile)
+	internal.Subscribe(hooks.Handle)
+	internal.OnExit(hooks.Wait)
+
+	// Keep a watch history in the database
+	internal.Subscribe(func(event internal.Event) {
+		switch event.Type {
+		case internal.EventEpisodeStart, internal.EventEpisodeCompleted, internal.EventShowFinished:
+			if err := internal.LocalRecordEvent(databaseFile, event); err != nil {
+				internal.Log(fmt.Sprintf("Error recording watch event: %v", err), logFile)
+			}
+		}
+	})
+
+	// Send notifications to the desktop and push services
+	if sinks := internal.NotificationSinksFromConfig(&userOctoConfig); len(sinks) > 0 {
+		notifications := internal.NewNotifications(sinks, logFile)
+		internal.Subscribe(notifications.Handle)
+		internal.OnExit(notifications.Wait)
+		if notifications.Wants(internal.EventNewEpisode) {
+			go func() {
+				if err := internal.CheckNewEpisodes(databaseFile, filepath.Join(os.ExpandEnv(userOctoConfig.StoragePath), "episode_counts.json")); err != nil {
+					internal.Log(fmt.Sprintf("Error checking for new episodes: %v", err), logFile)
+				}
+			}()
+		}
+	}
+
+	var player internal.MediaPlayer
+	if *castEpisode {
+		player, err = startCast(vadapavPlaybackUrl+show.EpisodeID, userOctoConfig.CastDevice)
+	} else {
+		player, err = internal.NewMPVPlayer(vadapavPlaybackUrl+show.EpisodeID, userOctoConfig.AudioOnly, mpvArgs...)
+	}
+	if err != nil {
+		internal.Log(fmt.Sprintf("Error starting player: %v", err), logFile)
+		event := internal.NewEvent(internal.EventPlaybackError, showDetails, show, 0)
+		event.Error = err.Error()
+		internal.Emit(event)
 		internal.ExitOcto("", err)
 		return
 	}
+	// Keys, chapters and tracks are only available in mpv
+	mpv, isMPV := player.(*internal.MPVPlayer)
+	if isMPV {
+		user.Player.SocketPath = mpv.SocketPath
+	}
 
-    for {
+	// Scripts and remotes drive the session through the control API
+	var control *internal.ControlServer
+	var controlActions <-chan internal.PlayerAction
+	var showRequests <-chan string
+	if userOctoConfig.ControlAddress != "" {
+		control, err = internal.StartControlServer(userOctoConfig.ControlAddress, player, databaseFile, logFile)
+		if err != nil {
+			internal.Log(fmt.Sprintf("Error starting control server: %v", err), logFile)
+			internal.OctoOut(fmt.Sprintf("Error starting control server: %v", err))
+		} else {
+			internal.OnExit(func() { control.Close() })
+			controlActions = control.Actions()
+			showRequests = control.ShowRequests()
+			if control.Token != "" {
+				internal.OctoOut(fmt.Sprintf("Remote control available on %s, open it with ?token=%s", userOctoConfig.ControlAddress, control.Token))
+			} else {
+				internal.OctoOut(fmt.Sprintf("Remote control available on %s", userOctoConfig.ControlAddress))
+			}
+		}
+	}
 
-        // Get video duration
-        go func() {
-            for {
-                if user.Player.Started {
-                    if user.Player.Duration == 0 {
-                        // Get video duration
-                        durationPos, err := internal.MPVSendCommand(user.Player.SocketPath, []interface{}{"get_property", "duration"})
-                        if err != nil {
-                            internal.Log("Error getting video duration: "+err.Error(), logFile)
-                        } else if durationPos != nil {
-                            if duration, ok := durationPos.(float64); ok {
-                                user.Player.Duration = int(duration + 0.5) // Round to nearest integer
-                                internal.Log(fmt.Sprintf("Video duration: %d seconds", user.Player.Duration), logFile)
-                            } else {
-                                internal.Log("Error: duration is not a float64", logFile)
-                            }
-                        }
-                        break
-                    }
-                }
-                time.Sleep(1 * time.Second)
-            }
-        }()
+	// Media keys and desktop media widgets on Linux
+	var mpris *internal.MPRIS
+	var mprisActions <-chan internal.PlayerAction
+	if userOctoConfig.Mpris && runtime.GOOS == "linux" {
+		mpris, err = internal.StartMPRIS(player)
+		if err != nil {
+			internal.Log(fmt.Sprintf("Error starting MPRIS: %v", err), logFile)
+		} else {
+			internal.OnExit(mpris.Close)
+			mprisActions = mpris.Actions()
+		}
+	}
 
-        // Playback monitoring and database updates
-        skipLoop:
-        for {
-            time.Sleep(1 * time.Second)
+	var discord *internal.DiscordPresence
+	if userOctoConfig.DiscordPresence {
+		if userOctoConfig.DiscordClientID == "" {
+			internal.Log("DiscordPresence is enabled but DiscordClientID is empty", logFile)
+		} else {
+			discord = internal.NewDiscordPresence(userOctoConfig.DiscordClientID)
+			internal.OnExit(discord.Clear)
+		}
+	}
 
-            timePos, err := internal.MPVSendCommand(user.Player.SocketPath, []interface{}{"get_property", "time-pos"})
-            if err != nil {
-                internal.Log("Error getting time position: "+err.Error(), logFile)
-                // MPV closed or error occurred
-                // Check if we reached completion percentage before starting next episode
-                if user.Player.Started { 
-                    percentage := internal.PercentageWatched(show.PlaybackTime, user.Player.Duration)
-                    if err != nil {
-                        internal.Log("Error getting percentage watched: "+err.Error(), logFile)
-                    }
-                    internal.Log(fmt.Sprintf("Percentage watched: %f", percentage), logFile)
-                    internal.Log(fmt.Sprintf("Percentage to mark complete: %d", userOctoConfig.PercentageToMarkComplete), logFile)
-                    if percentage >= float64(userOctoConfig.PercentageToMarkComplete) {
-                        showDetails, err := internal.GetShow(show.ID)
-                        if err != nil {
-                            internal.Log(fmt.Sprintf("Error getting show details: %v", err), logFile)
-                            break skipLoop
-                        }
-
-                        nextEp := internal.GetNextEpisode(showDetails, show.EpisodeID)
-                        if nextEp != nil {
-                            internal.OctoOut(fmt.Sprintf("Starting next episode: S%02dE%02d", nextEp.Season, nextEp.Episode))
-                            show.EpisodeID = nextEp.ID
-                            show.PlaybackTime = 0
-                            // Remove MPV start from here and break the loop
-                            break skipLoop
-                        }
-                        if nextEp == nil {
-                            internal.OctoOut("No more episodes found")
-                            internal.ExitOcto("", nil)
-                        }
-                    } else {
-                        internal.ExitOcto("", nil)
-                    }
-                }
-                break skipLoop  // Add this to ensure we break the loop on any MPV error
-            }
+	// Episode IDs in mpv's playlist, indexed by playlist-pos
+	playlist := []string{show.EpisodeID}
+	playlistPos := 0
+	// Where to resume the next episode that starts, mpv already got it as --start for the first one
+	resumeAt := show.PlaybackTime
+	startPending := isMPV && user.Resume
+	// Show picked in the web remote, taken over once its episode starts playing
+	var pendingShow *internal.TVShow
+	var pendingDetails *internal.Show
+	var events <-chan internal.MPVEvent
+	limits := internal.NewSessionLimits(*sleepTimer, userOctoConfig.MaxEpisodesPerSession, userOctoConfig.StillWatchingAfter)
+	// Whether the current playlist switch was requested with a key rather than mpv advancing on its own
+	navigating := false
+	autoAdvanced := false
+	awaitingConfirmation := false
 
-            // Episode started
-            if timePos != nil {
-                if !user.Player.Started {
-                    user.Player.Started = true
-                    // Set the playback speed
-                    if userOctoConfig.SaveMpvSpeed {
-                        speedCmd := []interface{}{"set_property", "speed", user.Player.Speed}
-                        _, err := internal.MPVSendCommand(user.Player.SocketPath, speedCmd)
-                        if err != nil {
-                            internal.Log("Error setting playback speed: "+err.Error(), logFile)
-                        }
-                    }
-                }
+	// Per-episode state, reset whenever mpv moves to another playlist entry
+	var recorder internal.SkipRecorder
+	var chapterMarkers internal.SkipMarkers
+	var episodeStarted, chaptersLoaded, markedWatched, eofReached bool
+	skipped := make(map[string]bool)
+	selectedTracks := make(map[string]int)
+	season := 0
+	episodeTitle := show.EpisodeID
 
+	resetEpisode := func(episodeID string) {
+		show.EpisodeID = episodeID
+		show.PlaybackTime = 0
+		user.Player.Duration = 0
+		recorder = internal.SkipRecorder{}
+		chapterMarkers = internal.SkipMarkers{}
+		episodeStarted, chaptersLoaded, markedWatched, eofReached = false, false, false, false
+		skipped = make(map[string]bool)
+		selectedTracks = make(map[string]int)
+		season = 0
+		episodeTitle = episodeID
 
-                if user.Resume {
-                    internal.SeekMPV(user.Player.SocketPath, show.PlaybackTime)
-                    user.Resume = false
-                }
+		// Pick up an episode left partway through, unless a resume position is already waiting
+		if !user.Resume {
+			if state := internal.LocalGetEpisodeStates(databaseFile, show.ID)[episodeID]; state.InProgress() {
+				resumeAt = internal.ResumePosition(state.Position, state.LastWatched, &userOctoConfig)
+				user.Resume = resumeAt > 0
+			}
+		}
+	}
 
-                showPosition, ok := timePos.(float64)
-                if !ok {
-                    continue
-                }
+	nextEpisode := func() *internal.EpisodeEntry {
+		if showDetails == nil {
+			return nil
+		}
+		return internal.GetNextEpisode(showDetails, show.EpisodeID)
+	}
 
-                // Update playback time
-                show.PlaybackTime = int(showPosition + 0.5)
-                user.Player.Speed, err = internal.GetMPVPlaybackSpeed(user.Player.SocketPath)
-                if err != nil {
-                    internal.Log(fmt.Sprintf("Error getting playback speed: %v", err), logFile)
-                }
-                // Save to database
-                err = internal.LocalUpdateShow(databaseFile, show)
-                if err != nil {
-                    internal.Log(fmt.Sprintf("Error updating database: %v", err), logFile)
-                }
-            }
-        }
+	// The episode auto-advance continues with, passing over ones already watched
+	autoAdvanceEpisode := func() *internal.EpisodeEntry {
+		var states map[string]internal.EpisodeState
+		if userOctoConfig.SkipWatchedEpisodes {
+			states = internal.LocalGetEpisodeStates(databaseFile, show.ID)
+		}
+		return internal.AutoAdvanceEpisode(showDetails, show.EpisodeID, states, userOctoConfig.SkipWatchedEpisodes)
+	}
 
-        // Start the next episode after the skipLoop if we have one
-        if show.PlaybackTime == 0 {  // This indicates we're ready for next episode
-            var err error
-            user.Player.Duration = 0  // Reset duration for new episode
-            user.Player.Started = false  // Reset started flag
-            user.Player.SocketPath, err = internal.PlayWithMPV(fmt.Sprintf("%s%s", vadapavPlaybackUrl, show.EpisodeID))
-            if err != nil {
-                internal.Log(fmt.Sprintf("Error starting next episode: %v", err), logFile)
-                internal.ExitOcto("", err)
-            }
-        }
-    }
-}
+	// Tell hooks and integrations the episode was watched, and the show when it was the last episode
+	completeEpisode := func() {
+		markedWatched = true
+		internal.Emit(internal.NewEvent(internal.EventEpisodeCompleted, showDetails, show, user.Player.Duration))
+		if nextEpisode() == nil {
+			internal.Emit(internal.NewEvent(internal.EventShowFinished, showDetails, show, user.Player.Duration))
+		}
+	}
 
+	// The stretch of the current episode being watched, added to the history when the episode
+	// starts and brought up to date whenever progress is saved
+	var historyEntry *internal.HistoryEntry
+	updateHistory := func() {
+		if historyEntry == nil {
+			return
+		}
+		historyEntry.EndedAt = time.Now().Unix()
+		historyEntry.EndPosition = show.PlaybackTime
+		historyEntry.Speed = user.Player.Speed
+		historyEntry.Completed = markedWatched
+		if err := internal.LocalUpdateHistory(databaseFile, *historyEntry); err != nil {
+			internal.Log(fmt.Sprintf("Error updating history: %v", err), logFile)
+		}
+	}
+	endHistory := func() {
+		updateHistory()
+		historyEntry = nil
+	}
+
+	// Progress is saved every few seconds rather than every tick, and on pause, episode changes and exit
+	var lastSave time.Time
+	wasPaused := false
+	saveProgress := func() {
+		if err := internal.LocalUpdateShow(databaseFile, show); err != nil {
+			internal.Log(fmt.Sprintf("Error updating database: %v", err), logFile)
+		}
+		updateHistory()
+		lastSave = time.Now()
+	}
+	// Leaving an episode part-way, by quitting or moving on, ends its "now watching"
+	episodeStopped := false
+	stopEpisode := func() {
+		if episodeStarted && !markedWatched && !episodeStopped {
+			episodeStopped = true
+			internal.Emit(internal.NewEvent(internal.EventEpisodeStopped, showDetails, show, user.Player.Duration))
+		}
+	}
+	internal.OnExit(endHistory)
+	internal.OnExit(saveProgress)
+	internal.OnExit(stopEpisode)
+
+	// Replace whatever is queued after the current episode, so mpv continues with episodeID in the same window
+	queueEpisode := func(episodeID string) {
+		playlist = []string{show.EpisodeID}
+		playlistPos = 0
+		queueURL := ""
+		if episodeID != "" {
+			queueURL = vadapavPlaybackUrl + episodeID
+		}
+		if err := player.Queue(queueURL); err != nil {
+			internal.Log("Error queueing episode: "+err.Error(), logFile)
+			return
+		}
+		if episodeID != "" {
+			playlist = append(playlist, episodeID)
+		}
+	}
+
+	queueNext := func() {
+		nextID := ""
+		if nextEp := autoAdvanceEpisode(); autoAdvance && limits.CanAdvance() && nextEp != nil {
+			nextID = nextEp.ID
+		}
+		queueEpisode(nextID)
+	}
+
+	// Buttons pressed on desktop notifications
+	notificationActions := internal.NotificationActions()
+	// Record markers and end-of-file, and collect actions from keypresses in mpv, the control API and notifications
+	pollEvents := func() []internal.PlayerAction {
+		var actions []internal.PlayerAction
+		for {
+			select {
+			case action := <-controlActions:
+				actions = append(actions, action)
+			case action := <-mprisActions:
+				actions = append(actions, action)
+			case action := <-notificationActions:
+				actions = append(actions, action)
+			case event, ok := <-events:
+				if !ok {
+					events = nil
+					return actions
+				}
+				// A new file starting clears the end-file of the previous playlist entry
+				if event.Event == "start-file" || event.Event == "end-file" {
+					eofReached = event.Event == "end-file" && event.Reason == "eof"
+					continue
+				}
+				if action, ok := internal.ParseActionEvent(event); ok {
+					actions = append(actions, action)
+					continue
+				}
+				kind, ok := internal.ParseMarkEvent(event)
+				if !ok {
+					continue
+				}
+				if r, done := recorder.Mark(kind, show.PlaybackTime); done {
+					internal.SetSkipMarker(&show, season, kind, r)
+					internal.OctoOSD(player, fmt.Sprintf("Saved %s marker %s - %s", kind, internal.FormatTime(r.Start), internal.FormatTime(r.End)))
+				} else {
+					internal.OctoOSD(player, fmt.Sprintf("Marked %s start at %s, press again at its end", kind, internal.FormatTime(show.PlaybackTime)))
+				}
+			default:
+				return actions
+			}
+		}
+	}
+
+	// Completion rules look at the chapter or recorded outro for the start of the credits
+	episodeProgress := func() internal.EpisodeProgress {
+		markers := internal.EpisodeSkipMarkers(chapterMarkers, show.SkipMarkers, season)
+		return internal.EpisodeProgress{
+			Position:     show.PlaybackTime,
+			Duration:     user.Player.Duration,
+			EOFReached:   eofReached,
+			CreditsStart: markers.Outro.Start,
+		}
+	}
+
+	// The exit hooks save the loop's state, so on a signal the loop exits itself
+	signals := internal.ForwardSignals()
+
+	// Playback monitoring and database updates
+playbackLoop:
+	for {
+		select {
+		case <-signals:
+			internal.ExitOcto("", nil)
+		case <-time.After(1 * time.Second):
+		}
+
+		entry, err := player.Entry()
+		if err != nil {
+			// Player closed, move progress on to the next episode if this one was finished
+			internal.Log("Error getting playlist position: "+err.Error(), logFile)
+			pollEvents()
+			if markedWatched || (episodeStarted && internal.EpisodeComplete(&userOctoConfig, episodeProgress())) {
+				if !markedWatched {
+					completeEpisode()
+				}
+				endHistory()
+				if nextEp := autoAdvanceEpisode(); nextEp != nil {
+					show.EpisodeID = nextEp.ID
+					show.PlaybackTime = 0
+				} else {
+					internal.OctoOut("No more episodes found")
+				}
+				saveProgress()
+			}
+			internal.ExitOcto("", nil)
+		}
+
+		// Player moved on to another playlist entry
+		if entry != playlistPos && entry >= 0 && entry < len(playlist) {
+			playlistPos = entry
+			autoAdvanced = !navigating
+			navigating = false
+			// mpv moving on by itself means the previous episode played to its end
+			if autoAdvanced && episodeStarted && !markedWatched {
+				completeEpisode()
+			}
+			stopEpisode()
+			endHistory()
+			saveProgress()
+			if pendingShow != nil {
+				show, showDetails = *pendingShow, pendingDetails
+				pendingShow, pendingDetails = nil, nil
+				userOctoConfig, err = internal.LoadShowConfig(configFilePath, show.ID, globalOctoConfig, flagOverrides)
+				if err != nil {
+					internal.Log(fmt.Sprintf("Error loading show config: %v", err), logFile)
+				}
+				if userOctoConfig.SaveMpvSpeed && show.Speed > 0 {
+					player.SetSpeed(show.Speed)
+				}
+			}
+			resetEpisode(playlist[playlistPos])
+			continue
+		}
+
+		showPosition, loaded, err := player.Position()
+		if err != nil {
+			internal.Log("Error getting time position: "+err.Error(), logFile)
+			continue
+		}
+		if !loaded {
+			// Nothing loaded yet
+			continue
+		}
+
+		// Player started
+		if !user.Player.Started {
+			user.Player.Started = true
+
+			// Listen for octopus keypresses
+			if isMPV {
+				events, err = internal.MPVListenEvents(mpv.SocketPath)
+				if err != nil {
+					internal.Log("Error listening to mpv events: "+err.Error(), logFile)
+				}
+				if err := internal.BindOctoKeys(mpv.SocketPath, &userOctoConfig); err != nil {
+					internal.Log("Error binding keys: "+err.Error(), logFile)
+				}
+			}
+
+			if showDetails == nil {
+				showDetails, err = internal.GetShow(show.ID)
+				if err != nil {
+					internal.Log(fmt.Sprintf("Error getting show details: %v", err), logFile)
+				}
+			}
+			internal.Emit(internal.NewEvent(internal.EventSessionStart, showDetails, show, 0))
+		}
+
+		// Episode started
+		if !episodeStarted {
+			episodeStarted = true
+			episodeStopped = false
+			// Recorded markers are stored per season
+			if episode := internal.FindEpisode(showDetails, show.EpisodeID); episode != nil {
+				season = episode.Season
+			}
+			episodeTitle = internal.EpisodeTitle(showDetails, show.EpisodeID)
+
+			if user.Resume {
+				if startPending {
+					// --start applies to every playlist entry, so clear it before the next episode loads
+					if _, err := internal.MPVSendCommand(mpv.SocketPath, []interface{}{"set_property", "start", "none"}); err != nil {
+						internal.Log("Error resetting start position: "+err.Error(), logFile)
+					}
+					startPending = false
+				} else if err := player.Seek(resumeAt); err != nil {
+					internal.Log("Error seeking to resume position: "+err.Error(), logFile)
+				}
+				show.PlaybackTime = resumeAt
+				internal.OctoOSD(player, fmt.Sprintf("%s\nResumed from %s", episodeTitle, internal.FormatTime(show.PlaybackTime)))
+				user.Resume = false
+			} else {
+				internal.OctoOSD(player, episodeTitle)
+			}
+			internal.Emit(internal.NewEvent(internal.EventEpisodeStart, showDetails, show, user.Player.Duration))
+			historyEntry = &internal.HistoryEntry{
+				ShowID:        show.ID,
+				EpisodeID:     show.EpisodeID,
+				StartedAt:     time.Now().Unix(),
+				StartPosition: show.PlaybackTime,
+				Speed:         user.Player.Speed,
+			}
+			historyEntry.ID, err = internal.LocalAddHistory(databaseFile, *historyEntry)
+			if err != nil {
+				internal.Log(fmt.Sprintf("Error adding to history: %v", err), logFile)
+				historyEntry = nil
+			}
+			// Rofi mode has no terminal, so the notification offers the controls
+			if userOctoConfig.RofiSelection {
+				internal.OctoOut("Now playing "+episodeTitle,
+					internal.NotificationButton{Label: "Play next", Action: internal.ActionNextEpisode},
+					internal.NotificationButton{Label: "Stop", Action: internal.ActionStop},
+				)
+			}
+
+			// Pick audio and subtitles from the show's remembered tracks or the configured preferences
+			if isMPV {
+				selectedTracks, err = internal.ApplyTrackPreferences(mpv.SocketPath, &show, &userOctoConfig)
+				if err != nil {
+					internal.Log("Error selecting tracks: "+err.Error(), logFile)
+				}
+			}
+
+			// Pause for confirmation after too many episodes in a row without interaction
+			if limits.EpisodeStarted(autoAdvanced) {
+				if err := player.SetPaused(true); err != nil {
+					internal.Log("Error pausing playback: "+err.Error(), logFile)
+				}
+				player.ShowText("Are you still watching?\nUnpause to continue", time.Hour)
+				awaitingConfirmation = true
+			}
+
+			queueNext()
+			continue
+		}
+
+		if limits.SleepReached(time.Now()) {
+			saveProgress()
+			internal.OctoOSD(player, "Sleep timer reached, stopping playback")
+			time.Sleep(1 * time.Second)
+			player.Quit()
+			internal.ExitOcto("Sleep timer reached, progress saved", nil)
+		}
+
+		if awaitingConfirmation {
+			paused, err := player.Paused()
+			if err == nil && !paused {
+				awaitingConfirmation = false
+				limits.Confirmed()
+				player.ShowText("", 0)
+			}
+		}
+
+		// Get video duration
+		if user.Player.Duration == 0 {
+			duration, err := player.Duration()
+			if err != nil {
+				internal.Log("Error getting video duration: "+err.Error(), logFile)
+			} else if duration > 0 {
+				user.Player.Duration = int(duration + 0.5) // Round to nearest integer
+				internal.Log(fmt.Sprintf("Video duration: %d seconds", user.Player.Duration), logFile)
+				if err := internal.LocalSetEpisodeDuration(databaseFile, show.ID, show.EpisodeID, user.Player.Duration); err != nil {
+					internal.Log(fmt.Sprintf("Error saving episode duration: %v", err), logFile)
+				}
+			}
+		}
+
+		// Update playback time
+		show.PlaybackTime = int(showPosition + 0.5)
+
+		status := internal.SessionStatus{
+			ShowID:      show.ID,
+			EpisodeID:   show.EpisodeID,
+			Episode:     episodeTitle,
+			Duration:    float64(user.Player.Duration),
+			AutoAdvance: autoAdvance,
+		}
+		if control != nil {
+			control.SetStatus(status)
+		}
+		if mpris != nil || discord != nil {
+			status.Position = showPosition
+			status.Paused, _ = player.Paused()
+			status.Speed, _ = player.Speed()
+			showName := show.ID
+			if showDetails != nil {
+				showName = showDetails.Name
+			}
+			if mpris != nil {
+				mpris.Update(status, showName)
+			}
+			if discord != nil {
+				episodeCode := internal.EpisodeCode(showDetails, show.EpisodeID)
+				if episodeCode == "" {
+					episodeCode = episodeTitle
+				}
+				if err := discord.Update(showName, episodeCode, status.Position, status.Duration, status.Paused); err != nil {
+					internal.Log("Error updating Discord presence: "+err.Error(), logFile)
+				}
+			}
+		}
+
+		// Mirror pause, seeks, speed and episode changes with the watch party
+		if partySync != nil {
+			if target := partySync.Tick(player, show.ID, show.EpisodeID); target != "" {
+				internal.OctoOSD(player, "Watch party moved to "+internal.EpisodeTitle(showDetails, target))
+				queueEpisode(target)
+				navigating = true
+				if err := player.Next(); err != nil {
+					internal.Log("Error switching episode: "+err.Error(), logFile)
+				}
+				continue playbackLoop
+			}
+		}
+
+		actions := pollEvents()
+
+		for _, action := range actions {
+			limits.Confirmed()
+			if action == internal.ActionToggleAutoAdvance {
+				autoAdvance = !autoAdvance
+				queueNext()
+				internal.OctoOSD(player, fmt.Sprintf("Auto-advance: %t", autoAdvance))
+				continue
+			}
+
+			var target *internal.EpisodeEntry
+			if showDetails != nil {
+				if action == internal.ActionPreviousEpisode {
+					target = internal.GetPreviousEpisode(showDetails, show.EpisodeID)
+				} else {
+					target = internal.GetNextEpisode(showDetails, show.EpisodeID)
+				}
+			}
+
+			if action == internal.ActionStop {
+				saveProgress()
+				player.Quit()
+				internal.ExitOcto("Playback stopped, progress saved", nil)
+			}
+
+			if action == internal.ActionMarkWatchedStop {
+				if !markedWatched {
+					completeEpisode()
+				}
+				endHistory()
+				if target != nil {
+					show.EpisodeID = target.ID
+					show.PlaybackTime = 0
+				} else {
+					show.PlaybackTime = user.Player.Duration
+				}
+				saveProgress()
+				internal.OctoOSD(player, "Marked as watched")
+				// Give the message a moment on screen before closing the window
+				time.Sleep(1 * time.Second)
+				player.Quit()
+				internal.ExitOcto("Marked as watched", nil)
+			}
+
+			if target == nil {
+				internal.OctoOSD(player, fmt.Sprintf("No %s episode found", action))
+				continue
+			}
+			internal.OctoOSD(player, fmt.Sprintf("Loading %s episode: S%02dE%02d", action, target.Season, target.Episode))
+			queueEpisode(target.ID)
+			navigating = true
+			if err := player.Next(); err != nil {
+				internal.Log("Error switching episode: "+err.Error(), logFile)
+			}
+			continue playbackLoop
+		}
+
+		// Continue another show picked in the web remote
+		select {
+		case showID := <-showRequests:
+			if showID == show.ID || pendingShow != nil {
+				break
+			}
+			var target *internal.TVShow
+			for _, s := range internal.LocalGetAllShows(databaseFile) {
+				if s.ID == showID {
+					target = &s
+					break
+				}
+			}
+			if target == nil {
+				internal.Log("Requested show not in database: "+showID, logFile)
+				break
+			}
+			details, err := internal.GetShow(target.ID)
+			if err != nil {
+				internal.Log(fmt.Sprintf("Error getting show details: %v", err), logFile)
+				break
+			}
+
+			saveProgress()
+			internal.OctoOSD(player, "Switching to "+details.Name)
+			queueEpisode(target.EpisodeID)
+			navigating = true
+			if err := player.Next(); err != nil {
+				internal.Log("Error switching show: "+err.Error(), logFile)
+				break
+			}
+			pendingShow, pendingDetails = target, details
+			if scrobbler != nil {
+				scrobbler.SetMapping(target.ID, target.TrackerID)
+			}
+			resumeAt = internal.ResumePosition(target.PlaybackTime, target.LastWatched, &userOctoConfig)
+			user.Resume = resumeAt > 0
+			continue playbackLoop
+		default:
+		}
+
+		// Skip intro/outro using chapters, falling back to recorded markers
+		if !chaptersLoaded && isMPV && user.Player.Duration > 0 {
+			chapters, err := internal.GetMPVChapters(mpv.SocketPath)
+			if err != nil {
+				internal.Log("Error getting chapters: "+err.Error(), logFile)
+			}
+			chapterMarkers = internal.ChapterSkipMarkers(chapters, user.Player.Duration)
+			chaptersLoaded = true
+		}
+		markers := internal.EpisodeSkipMarkers(chapterMarkers, show.SkipMarkers, season)
+		for kind, r := range map[string]internal.SkipRange{"intro": markers.Intro, "outro": markers.Outro} {
+			enabled := (kind == "intro" && userOctoConfig.SkipIntro) || (kind == "outro" && userOctoConfig.SkipOutro)
+			if !enabled || skipped[kind] || !r.Contains(show.PlaybackTime) {
+				continue
+			}
+			if err := player.Seek(r.End); err != nil {
+				internal.Log("Error skipping "+kind+": "+err.Error(), logFile)
+				continue
+			}
+			skipped[kind] = true
+			show.PlaybackTime = r.End
+			internal.OctoOSD(player, fmt.Sprintf("Skipped %s", kind))
+		}
+
+		// Let the viewer know once the episode counts as watched
+		if !markedWatched && internal.EpisodeComplete(&userOctoConfig, episodeProgress()) {
+			completeEpisode()
+			message := "Marked as watched"
+			if nextEp := autoAdvanceEpisode(); autoAdvance && nextEp != nil {
+				if limits.CanAdvance() {
+					message += fmt.Sprintf("\nNext episode S%02dE%02d loading after this one", nextEp.Season, nextEp.Episode)
+				} else {
+					message += "\nEpisode limit reached, stopping after this one"
+				}
+			}
+			internal.OctoOSD(player, message)
+		}
+
+		if isMPV {
+			if err := internal.RememberTrackChanges(mpv.SocketPath, &show, selectedTracks); err != nil {
+				internal.Log("Error checking selected tracks: "+err.Error(), logFile)
+			}
+		}
+
+		user.Player.Speed, err = player.Speed()
+		if err != nil {
+			internal.Log(fmt.Sprintf("Error getting playback speed: %v", err), logFile)
+		} else if userOctoConfig.SaveMpvSpeed && user.Player.Speed > 0 {
+			show.Speed = user.Player.Speed
+		}
+		// Save every SaveInterval seconds, and right away when playback gets paused
+		paused, err := player.Paused()
+		if err != nil {
+			internal.Log(fmt.Sprintf("Error getting pause state: %v", err), logFile)
+		}
+		if (paused && !wasPaused) || time.Since(lastSave) >= time.Duration(userOctoConfig.SaveInterval)*time.Second {
+			saveProgress()
+		}
+		if err == nil && paused != wasPaused && episodeStarted {
+			if paused {
+				internal.Emit(internal.NewEvent(internal.EventPaused, showDetails, show, user.Player.Duration))
+			} else {
+				internal.Emit(internal.NewEvent(internal.EventResumed, showDetails, show, user.Player.Duration))
+			}
+		}
+		wasPaused = paused
+	}
+}
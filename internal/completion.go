@@ -0,0 +1,30 @@
+package internal
+
+// EpisodeProgress is the playback state the completion rules are checked against
+type EpisodeProgress struct {
+	Position     int
+	Duration     int
+	EOFReached   bool
+	CreditsStart int // Start of the credits/ending chapter or recorded outro, 0 if unknown
+}
+
+// EpisodeComplete reports whether any of the enabled completion rules is met
+func EpisodeComplete(config *OctoConfig, progress EpisodeProgress) bool {
+	if config.CompleteOnEOF && progress.EOFReached {
+		return true
+	}
+	if progress.Duration <= 0 {
+		return false
+	}
+
+	if config.PercentageToMarkComplete > 0 && PercentageWatched(progress.Position, progress.Duration) >= float64(config.PercentageToMarkComplete) {
+		return true
+	}
+	if config.CompleteWhenRemaining > 0 && progress.Duration-progress.Position <= config.CompleteWhenRemaining {
+		return true
+	}
+	if config.CompleteOnCreditsChapter && progress.CreditsStart > 0 && progress.Position >= progress.CreditsStart {
+		return true
+	}
+	return false
+}
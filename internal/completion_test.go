@@ -0,0 +1,41 @@
+package internal
+
+import "testing"
+
+func TestEpisodeComplete(t *testing.T) {
+	config := OctoConfig{
+		PercentageToMarkComplete: 92,
+		CompleteWhenRemaining:    60,
+		CompleteOnEOF:            true,
+		CompleteOnCreditsChapter: true,
+	}
+	percentageOnly := OctoConfig{PercentageToMarkComplete: 92}
+
+	tests := []struct {
+		name     string
+		config   OctoConfig
+		progress EpisodeProgress
+		want     bool
+	}{
+		{"just started", config, EpisodeProgress{Position: 60, Duration: 1440}, false},
+		{"percentage reached", config, EpisodeProgress{Position: 1325, Duration: 1440}, true},
+		{"percentage just short", percentageOnly, EpisodeProgress{Position: 1320, Duration: 1440}, false},
+		{"little time remaining", config, EpisodeProgress{Position: 1200, Duration: 1250}, true},
+		{"remaining rule off", percentageOnly, EpisodeProgress{Position: 1200, Duration: 1320}, false},
+		{"credits started", config, EpisodeProgress{Position: 1250, Duration: 1440, CreditsStart: 1240}, true},
+		{"before the credits", config, EpisodeProgress{Position: 1200, Duration: 1440, CreditsStart: 1240}, false},
+		{"credits rule off", percentageOnly, EpisodeProgress{Position: 1250, Duration: 1440, CreditsStart: 1240}, false},
+		{"end of file", config, EpisodeProgress{Position: 10, Duration: 1440, EOFReached: true}, true},
+		{"end of file without a duration", config, EpisodeProgress{EOFReached: true}, true},
+		{"end of file rule off", percentageOnly, EpisodeProgress{Position: 10, Duration: 1440, EOFReached: true}, false},
+		{"unknown duration", config, EpisodeProgress{Position: 1400}, false},
+		{"every rule off", OctoConfig{}, EpisodeProgress{Position: 1440, Duration: 1440, EOFReached: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EpisodeComplete(&tt.config, tt.progress); got != tt.want {
+				t.Errorf("EpisodeComplete(%+v) = %v, want %v", tt.progress, got, tt.want)
+			}
+		})
+	}
+}
@@ -15,9 +15,52 @@ type OctoConfig struct {
 	Player                  string `config:"Player"`
 	StoragePath             string `config:"StoragePath"`
 	PercentageToMarkComplete int    `config:"PercentageToMarkComplete"`
+	CompleteWhenRemaining   int    `config:"CompleteWhenRemaining"`
+	CompleteOnEOF           bool   `config:"CompleteOnEOF"`
+	CompleteOnCreditsChapter bool  `config:"CompleteOnCreditsChapter"`
 	NextEpisodePrompt       bool   `config:"NextEpisodePrompt"`
 	RofiSelection           bool   `config:"RofiSelection"`
 	SaveMpvSpeed            bool   `config:"SaveMpvSpeed"`
+	SkipIntro               bool   `config:"SkipIntro"`
+	SkipOutro               bool   `config:"SkipOutro"`
+	SkipWatchedEpisodes     bool   `config:"SkipWatchedEpisodes"`
+	OsdMessages             bool   `config:"OsdMessages"`
+	AudioOnly               bool   `config:"AudioOnly"`
+	ExternalPlayerCommand   string `config:"ExternalPlayerCommand"`
+	CastDevice              string `config:"CastDevice"`
+	ControlAddress          string `config:"ControlAddress"`
+	Mpris                   bool   `config:"Mpris"`
+	DiscordPresence         bool   `config:"DiscordPresence"`
+	DiscordClientID         string `config:"DiscordClientID"`
+	HooksDir                string `config:"HooksDir"`
+	HookTimeout             int    `config:"HookTimeout"`
+	Scrobble                bool   `config:"Scrobble"`
+	TrackerURL              string `config:"TrackerURL"`
+	TrackerClientID         string `config:"TrackerClientID"`
+	TrackerClientSecret     string `config:"TrackerClientSecret"`
+	DesktopNotifyEvents     string `config:"DesktopNotifyEvents"`
+	WebhookURL              string `config:"WebhookURL"`
+	WebhookEvents           string `config:"WebhookEvents"`
+	NtfyURL                 string `config:"NtfyURL"`
+	NtfyToken               string `config:"NtfyToken"`
+	NtfyEvents              string `config:"NtfyEvents"`
+	GotifyURL               string `config:"GotifyURL"`
+	GotifyToken             string `config:"GotifyToken"`
+	GotifyEvents            string `config:"GotifyEvents"`
+	ExternalPlayerRecord    bool   `config:"ExternalPlayerRecord"`
+	ResumeRewind            int    `config:"ResumeRewind"`
+	SaveInterval            int    `config:"SaveInterval"`
+	AudioPreference         string `config:"AudioPreference"`
+	SubtitlePreference      string `config:"SubtitlePreference"`
+	ResumeRewindScale       bool   `config:"ResumeRewindScale"`
+	MaxEpisodesPerSession   int    `config:"MaxEpisodesPerSession"`
+	StillWatchingAfter      int    `config:"StillWatchingAfter"`
+	KeyNextEpisode          string `config:"KeyNextEpisode"`
+	KeyPreviousEpisode      string `config:"KeyPreviousEpisode"`
+	KeyMarkWatched          string `config:"KeyMarkWatched"`
+	KeyToggleAutoAdvance    string `config:"KeyToggleAutoAdvance"`
+	KeyMarkIntro            string `config:"KeyMarkIntro"`
+	KeyMarkOutro            string `config:"KeyMarkOutro"`
 }
 
 // Default configuration values as a map
@@ -26,9 +69,52 @@ func defaultConfigMap() map[string]string {
 		"Player":                  "mpv",
 		"StoragePath":             "$HOME/.local/share/octo",
 		"PercentageToMarkComplete": "92",
+		"CompleteWhenRemaining":   "0",
+		"CompleteOnEOF":           "true",
+		"CompleteOnCreditsChapter": "true",
 		"NextEpisodePrompt":       "false",
 		"RofiSelection":           "false",
 		"SaveMpvSpeed":            "true",
+		"SkipIntro":               "true",
+		"SkipOutro":               "true",
+		"SkipWatchedEpisodes":     "true",
+		"OsdMessages":             "true",
+		"AudioOnly":               "false",
+		"ExternalPlayerCommand":   "",
+		"CastDevice":              "",
+		"ControlAddress":          "",
+		"Mpris":                   "true",
+		"DiscordPresence":         "false",
+		"DiscordClientID":         "",
+		"HooksDir":                "$HOME/.config/octo/hooks",
+		"HookTimeout":             "10",
+		"Scrobble":                "false",
+		"TrackerURL":              "https://api.trakt.tv",
+		"TrackerClientID":         "",
+		"TrackerClientSecret":     "",
+		"DesktopNotifyEvents":     "",
+		"WebhookURL":              "",
+		"WebhookEvents":           "all",
+		"NtfyURL":                 "",
+		"NtfyToken":               "",
+		"NtfyEvents":              "show-finished,playback-error,new-episode",
+		"GotifyURL":               "",
+		"GotifyToken":             "",
+		"GotifyEvents":            "show-finished,playback-error,new-episode",
+		"ExternalPlayerRecord":    "true",
+		"ResumeRewind":            "10",
+		"SaveInterval":            "10",
+		"AudioPreference":         "",
+		"SubtitlePreference":      "",
+		"ResumeRewindScale":       "true",
+		"MaxEpisodesPerSession":   "0",
+		"StillWatchingAfter":      "0",
+		"KeyNextEpisode":          ">",
+		"KeyPreviousEpisode":      "<",
+		"KeyMarkWatched":          "alt+w",
+		"KeyToggleAutoAdvance":    "alt+a",
+		"KeyMarkIntro":            "alt+i",
+		"KeyMarkOutro":            "alt+o",
 	}
 }
 
@@ -45,9 +131,32 @@ func GetGlobalConfig() *OctoConfig {
 			Player:                  "mpv",
 			StoragePath:            "$HOME/.local/share/octo", 
 			PercentageToMarkComplete: 92,
+			CompleteOnEOF:          true,
+			CompleteOnCreditsChapter: true,
 			NextEpisodePrompt:      false,
 			RofiSelection:          false,
 			SaveMpvSpeed:           true,
+			SkipIntro:              true,
+			SkipOutro:              true,
+			SkipWatchedEpisodes:    true,
+			OsdMessages:            true,
+			Mpris:                  true,
+			HooksDir:               "$HOME/.config/octo/hooks",
+			HookTimeout:            10,
+			TrackerURL:             "https://api.trakt.tv",
+			WebhookEvents:          "all",
+			NtfyEvents:             "show-finished,playback-error,new-episode",
+			GotifyEvents:           "show-finished,playback-error,new-episode",
+			ResumeRewind:           10,
+			SaveInterval:           10,
+			ResumeRewindScale:      true,
+			ExternalPlayerRecord:   true,
+			KeyNextEpisode:         ">",
+			KeyPreviousEpisode:     "<",
+			KeyMarkWatched:         "alt+w",
+			KeyToggleAutoAdvance:   "alt+a",
+			KeyMarkIntro:           "alt+i",
+			KeyMarkOutro:           "alt+o",
 		}
 		globalConfig = &defaultConfig
 	}
@@ -179,10 +288,59 @@ func saveConfigToFile(path string, configMap map[string]string) error {
 	return writer.Flush()
 }
 
+// ShowConfigPath returns the per-show override file that sits next to the main config file
+func ShowConfigPath(configPath string, showID string) string {
+	return filepath.Join(filepath.Dir(os.ExpandEnv(configPath)), "shows", showID+".conf")
+}
+
+// CreateShowConfig writes an empty per-show override file if there isn't one yet and returns its path
+func CreateShowConfig(configPath string, showID string, showName string) (string, error) {
+	showConfigPath := ShowConfigPath(configPath, showID)
+	if _, err := os.Stat(showConfigPath); err == nil {
+		return showConfigPath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(showConfigPath), 0755); err != nil {
+		return "", fmt.Errorf("error creating directory: %v", err)
+	}
+
+	header := fmt.Sprintf("# Settings for %s\n# Any key from octo.conf can be set here to override it for this show, e.g.\n# PercentageToMarkComplete=85\n", showName)
+	if err := os.WriteFile(showConfigPath, []byte(header), 0644); err != nil {
+		return "", fmt.Errorf("error creating file: %v", err)
+	}
+	return showConfigPath, nil
+}
+
+// LoadShowConfig applies the per-show overrides for showID on top of base, then overrides
+// (config keys set on the command line), which win over both
+func LoadShowConfig(configPath string, showID string, base OctoConfig, overrides map[string]string) (OctoConfig, error) {
+	showConfigPath := ShowConfigPath(configPath, showID)
+	if _, err := os.Stat(showConfigPath); os.IsNotExist(err) {
+		applyConfigMap(&base, overrides)
+		return base, nil
+	}
+
+	configMap, err := loadConfigFromFile(showConfigPath)
+	if err != nil {
+		applyConfigMap(&base, overrides)
+		return base, fmt.Errorf("error loading show config file: %v", err)
+	}
+
+	applyConfigMap(&base, configMap)
+	applyConfigMap(&base, overrides)
+	return base, nil
+}
+
 // Populate the OctoConfig struct from a map
 func populateConfig(configMap map[string]string) OctoConfig {
 	config := OctoConfig{}
-	configValue := reflect.ValueOf(&config).Elem()
+	applyConfigMap(&config, configMap)
+	return config
+}
+
+// Set the OctoConfig fields whose keys are present in the map
+func applyConfigMap(config *OctoConfig, configMap map[string]string) {
+	configValue := reflect.ValueOf(config).Elem()
 
 	for i := 0; i < configValue.NumField(); i++ {
 		field := configValue.Type().Field(i)
@@ -205,7 +363,5 @@ func populateConfig(configMap map[string]string) OctoConfig {
 			}
 		}
 	}
-
-	return config
 }
 
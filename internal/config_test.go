@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyConfigMap(t *testing.T) {
+	tests := []struct {
+		name      string
+		configMap map[string]string
+		check     func(config OctoConfig) bool
+	}{
+		{"string", map[string]string{"Player": "vlc"}, func(c OctoConfig) bool { return c.Player == "vlc" }},
+		{"int", map[string]string{"PercentageToMarkComplete": "85"}, func(c OctoConfig) bool { return c.PercentageToMarkComplete == 85 }},
+		{"bool", map[string]string{"SkipIntro": "false"}, func(c OctoConfig) bool { return !c.SkipIntro }},
+		{"bad int is zero", map[string]string{"SaveInterval": "soon"}, func(c OctoConfig) bool { return c.SaveInterval == 0 }},
+		{"unknown key ignored", map[string]string{"NoSuchKey": "1"}, func(c OctoConfig) bool { return c.Player == "mpv" }},
+		{"missing keys kept", map[string]string{}, func(c OctoConfig) bool {
+			return c.Player == "mpv" && c.PercentageToMarkComplete == 92 && c.SkipIntro
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := OctoConfig{Player: "mpv", PercentageToMarkComplete: 92, SkipIntro: true, SaveInterval: 10}
+			applyConfigMap(&config, tt.configMap)
+			if !tt.check(config) {
+				t.Errorf("applyConfigMap(%v) = %+v", tt.configMap, config)
+			}
+		})
+	}
+}
+
+func TestLoadShowConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "octo.conf")
+	showConfigPath := ShowConfigPath(configPath, "show")
+	if err := os.MkdirAll(filepath.Dir(showConfigPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(showConfigPath, []byte("# comment\nPercentageToMarkComplete=80\nSkipIntro=false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := OctoConfig{PercentageToMarkComplete: 92, SkipIntro: true, SkipOutro: true}
+
+	tests := []struct {
+		name       string
+		showID     string
+		overrides  map[string]string
+		percentage int
+		skipIntro  bool
+	}{
+		{"show settings", "show", nil, 80, false},
+		{"flags win over show settings", "show", map[string]string{"SkipIntro": "true"}, 80, true},
+		{"flags without show settings", "other", map[string]string{"PercentageToMarkComplete": "50"}, 50, true},
+		{"no show settings", "other", nil, 92, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadShowConfig(configPath, tt.showID, base, tt.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.PercentageToMarkComplete != tt.percentage || config.SkipIntro != tt.skipIntro || !config.SkipOutro {
+				t.Errorf("got %+v", config)
+			}
+		})
+	}
+}
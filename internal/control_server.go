@@ -0,0 +1,384 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SessionStatus is what the control API reports about the running session
+type SessionStatus struct {
+	ShowID      string  `json:"show_id"`
+	EpisodeID   string  `json:"episode_id"`
+	Episode     string  `json:"episode"`
+	Position    float64 `json:"position"`
+	Duration    float64 `json:"duration"`
+	Paused      bool    `json:"paused"`
+	Speed       float64 `json:"speed"`
+	AutoAdvance bool    `json:"auto_advance"`
+}
+
+//go:embed web/remote.html
+var remotePage []byte
+
+// ShowSummary is an entry of the continue-watching list
+type ShowSummary struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	EpisodeID   string `json:"episode_id"`
+	Episode     string `json:"episode"`
+	Position    int    `json:"position"`
+	LastWatched int64  `json:"last_watched"`
+}
+
+// ControlServer exposes the running session over HTTP. Pausing and seeking go straight to the
+// player, episode changes and stopping are handed to the playback loop through Actions.
+type ControlServer struct {
+	Player       MediaPlayer
+	DatabaseFile string
+	Mux          *http.ServeMux
+	LogFile      string
+	// Required from clients when listening beyond this machine, empty otherwise
+	Token        string
+	listenAddr   net.Addr
+	server       *http.Server
+	actions      chan PlayerAction
+	showRequests chan string
+	mu           sync.Mutex
+	status       SessionStatus
+	// Show details by ID, fetched once for the continue-watching list
+	details map[string]*Show
+}
+
+// StartControlServer listens on a TCP address such as "127.0.0.1:8787", or on a unix socket
+// given as "unix:/path/to/socket". The web remote lists the shows in databaseFile.
+func StartControlServer(address string, player MediaPlayer, databaseFile string, logFile string) (*ControlServer, error) {
+	var listener net.Listener
+	var err error
+	if socketPath, ok := strings.CutPrefix(address, "unix:"); ok {
+		// Remove a socket left behind by a previous session, but never a regular file
+		if info, err := os.Lstat(socketPath); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("failed to start control server: %s exists and is not a socket", socketPath)
+			}
+			os.Remove(socketPath)
+		}
+		listener, err = net.Listen("unix", socketPath)
+	} else {
+		listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start control server: %w", err)
+	}
+
+	s := &ControlServer{
+		Player:       player,
+		DatabaseFile: databaseFile,
+		Mux:          http.NewServeMux(),
+		LogFile:      logFile,
+		listenAddr:   listener.Addr(),
+		actions:      make(chan PlayerAction, 8),
+		showRequests: make(chan string, 1),
+		details:      make(map[string]*Show),
+	}
+	s.Mux.HandleFunc("/", s.handleRemote)
+	s.Mux.HandleFunc("/api/shows", s.handleShows)
+	s.Mux.HandleFunc("/api/play-show", s.post(s.playShow))
+	s.Mux.HandleFunc("/api/status", s.handleStatus)
+	s.Mux.HandleFunc("/api/play", s.post(func(r *http.Request) error { return s.Player.SetPaused(false) }))
+	s.Mux.HandleFunc("/api/pause", s.post(func(r *http.Request) error { return s.Player.SetPaused(true) }))
+	s.Mux.HandleFunc("/api/toggle", s.post(s.togglePause))
+	s.Mux.HandleFunc("/api/seek", s.post(s.seek))
+	s.Mux.HandleFunc("/api/next", s.post(s.queueAction(ActionNextEpisode)))
+	s.Mux.HandleFunc("/api/previous", s.post(s.queueAction(ActionPreviousEpisode)))
+	s.Mux.HandleFunc("/api/stop", s.post(s.queueAction(ActionStop)))
+
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to start control server: %w", err)
+		}
+		s.Token = hex.EncodeToString(token)
+	}
+
+	s.server = &http.Server{Handler: s.guard(s.Mux)}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			Log(fmt.Sprintf("Control server stopped: %v", err), s.LogFile)
+		}
+	}()
+	return s, nil
+}
+
+// Close stops the server, removing its unix socket
+func (s *ControlServer) Close() error {
+	return s.server.Close()
+}
+
+const controlTokenCookie = "octopus_token"
+
+// guard turns away requests made by other web pages and, when a token is set, requests without it.
+// The token is taken from ?token=, an "Authorization: Bearer" header or the cookie the remote
+// page sets once opened with ?token=. Without a token the Host must name this machine, so a page
+// whose domain was rebound to 127.0.0.1 can't pass the Origin check with its own name.
+func (s *ControlServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Token == "" && !s.localHost(r.Host) {
+			writeJSONError(w, http.StatusForbidden, fmt.Errorf("unknown host %q", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			originURL, err := url.Parse(origin)
+			if err != nil || originURL.Host != r.Host {
+				writeJSONError(w, http.StatusForbidden, fmt.Errorf("cross-origin requests are not allowed"))
+				return
+			}
+		}
+
+		if s.Token != "" {
+			token := r.URL.Query().Get("token")
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				token = bearer
+			}
+			if cookie, err := r.Cookie(controlTokenCookie); err == nil && token == "" {
+				token = cookie.Value
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+				writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong token"))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     controlTokenCookie,
+				Value:    s.Token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localHost reports whether host, as sent in a request, is a loopback name or the address the server
+// listens on. Browsers can't reach unix sockets, so any host is fine there.
+func (s *ControlServer) localHost(host string) bool {
+	if _, ok := s.listenAddr.(*net.TCPAddr); !ok {
+		return true
+	}
+	if host == s.listenAddr.String() {
+		return true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	switch strings.Trim(host, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// Actions returns the requests the playback loop has to carry out
+func (s *ControlServer) Actions() <-chan PlayerAction {
+	return s.actions
+}
+
+// ShowRequests returns the IDs of shows the web remote asked to switch to
+func (s *ControlServer) ShowRequests() <-chan string {
+	return s.showRequests
+}
+
+// SetStatus updates what the loop knows about the session; position and pause state are read live
+func (s *ControlServer) SetStatus(status SessionStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Status returns the session status with the player's current position, duration, pause state and speed
+func (s *ControlServer) Status() SessionStatus {
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+
+	if position, loaded, err := s.Player.Position(); err == nil && loaded {
+		status.Position = position
+	}
+	if duration, err := s.Player.Duration(); err == nil && duration > 0 {
+		status.Duration = duration
+	}
+	if paused, err := s.Player.Paused(); err == nil {
+		status.Paused = paused
+	}
+	if speed, err := s.Player.Speed(); err == nil {
+		status.Speed = speed
+	}
+	return status
+}
+
+func (s *ControlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("use GET"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+func (s *ControlServer) handleRemote(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(remotePage)
+}
+
+// handleShows lists the shows in the database, most recently watched first
+func (s *ControlServer) handleShows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("use GET"))
+		return
+	}
+
+	shows := LocalGetAllShows(s.DatabaseFile)
+	sort.SliceStable(shows, func(i, j int) bool {
+		return shows[i].LastWatched > shows[j].LastWatched
+	})
+
+	summaries := make([]ShowSummary, 0, len(shows))
+	for _, show := range shows {
+		details := s.showDetails(show.ID)
+		name := show.ID
+		if details != nil {
+			name = details.Name
+		}
+		summaries = append(summaries, ShowSummary{
+			ID:          show.ID,
+			Name:        name,
+			EpisodeID:   show.EpisodeID,
+			Episode:     EpisodeTitle(details, show.EpisodeID),
+			Position:    show.PlaybackTime,
+			LastWatched: show.LastWatched,
+		})
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *ControlServer) showDetails(showID string) *Show {
+	s.mu.Lock()
+	details, ok := s.details[showID]
+	s.mu.Unlock()
+	if ok {
+		return details
+	}
+
+	details, err := GetShow(showID)
+	if err != nil {
+		// Try again on the next request
+		return nil
+	}
+	s.mu.Lock()
+	s.details[showID] = details
+	s.mu.Unlock()
+	return details
+}
+
+// playShow asks the playback loop to continue another show from the database
+func (s *ControlServer) playShow(r *http.Request) error {
+	showID := r.FormValue("id")
+	if showID == "" {
+		return fmt.Errorf("play-show needs id=<show id>")
+	}
+	select {
+	case s.showRequests <- showID:
+		return nil
+	default:
+		return fmt.Errorf("already switching shows")
+	}
+}
+
+// post wraps a command endpoint, answering with the new status on success
+func (s *ControlServer) post(command func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("use POST"))
+			return
+		}
+		if err := command(r); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Status())
+	}
+}
+
+func (s *ControlServer) togglePause(r *http.Request) error {
+	paused, err := s.Player.Paused()
+	if err != nil {
+		return err
+	}
+	return s.Player.SetPaused(!paused)
+}
+
+// seek jumps to ?to=seconds, or moves by ?by=seconds relative to the current position
+func (s *ControlServer) seek(r *http.Request) error {
+	if to := r.FormValue("to"); to != "" {
+		seconds, err := strconv.ParseFloat(to, 64)
+		if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return fmt.Errorf("invalid seek position %q", to)
+		}
+		if seconds < 0 {
+			seconds = 0
+		}
+		return s.Player.Seek(int(seconds))
+	}
+
+	by := r.FormValue("by")
+	offset, err := strconv.ParseFloat(by, 64)
+	if err != nil || math.IsNaN(offset) || math.IsInf(offset, 0) {
+		return fmt.Errorf("seek needs to=<seconds> or by=<seconds>")
+	}
+	position, _, err := s.Player.Position()
+	if err != nil {
+		return err
+	}
+	target := int(position + offset)
+	if target < 0 {
+		target = 0
+	}
+	return s.Player.Seek(target)
+}
+
+func (s *ControlServer) queueAction(action PlayerAction) func(r *http.Request) error {
+	return func(r *http.Request) error {
+		select {
+		case s.actions <- action:
+			return nil
+		default:
+			return fmt.Errorf("too many pending requests")
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlServerGuard(t *testing.T) {
+	loopback := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8787}
+	network := &net.TCPAddr{IP: net.IPv4zero, Port: 8787}
+	tests := []struct {
+		name   string
+		addr   net.Addr
+		token  string
+		target string
+		header map[string]string
+		want   int
+	}{
+		{"same origin", loopback, "", "http://127.0.0.1:8787/api/status", map[string]string{"Origin": "http://127.0.0.1:8787"}, http.StatusOK},
+		{"no origin", loopback, "", "http://127.0.0.1:8787/api/status", nil, http.StatusOK},
+		{"localhost", loopback, "", "http://localhost:8787/api/status", map[string]string{"Origin": "http://localhost:8787"}, http.StatusOK},
+		{"ipv6 loopback", loopback, "", "http://[::1]:8787/api/status", nil, http.StatusOK},
+		{"other origin", loopback, "", "http://127.0.0.1:8787/api/status", map[string]string{"Origin": "http://evil.test"}, http.StatusForbidden},
+		{"rebound domain", loopback, "", "http://evil.test:8787/api/stop", map[string]string{"Origin": "http://evil.test:8787"}, http.StatusForbidden},
+		{"rebound domain without origin", loopback, "", "http://evil.test:8787/api/status", nil, http.StatusForbidden},
+		{"any host on a unix socket", &net.UnixAddr{Name: "/tmp/octopus.sock", Net: "unix"}, "", "http://octopus/api/status", nil, http.StatusOK},
+		{"network name with token", network, "secret", "http://pc.lan:8787/api/status?token=secret", map[string]string{"Origin": "http://pc.lan:8787"}, http.StatusOK},
+		{"missing token", network, "secret", "http://pc.lan:8787/api/status", nil, http.StatusUnauthorized},
+		{"wrong token", network, "secret", "http://pc.lan:8787/api/status?token=guess", nil, http.StatusUnauthorized},
+		{"query token", network, "secret", "http://pc.lan:8787/api/status?token=secret", nil, http.StatusOK},
+		{"bearer token", network, "secret", "http://pc.lan:8787/api/status", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"cookie token", network, "secret", "http://pc.lan:8787/api/status", map[string]string{"Cookie": controlTokenCookie + "=secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ControlServer{Token: tt.token, listenAddr: tt.addr}
+			handler := s.guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestControlServerSeek(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"to=300", 300, false},
+		{"to=-20", 0, false},
+		{"by=-10", 90, false},
+		{"by=-500", 0, false},
+		{"to=NaN", 0, true},
+		{"to=soon", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			player := &fakePlayer{position: 100, speed: 1}
+			s := &ControlServer{Player: player}
+			err := s.seek(httptest.NewRequest(http.MethodPost, "/api/seek?"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("seek(%q) error = %v", tt.query, err)
+			}
+			if !tt.wantErr && (len(player.seeks) != 1 || player.seeks[0] != tt.want) {
+				t.Errorf("seeks = %v, want [%d]", player.seeks, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartControlServerKeepsFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StartControlServer("unix:"+path, &fakePlayer{}, "", ""); err == nil {
+		t.Fatal("started on a regular file")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep me" {
+		t.Fatalf("file was touched: %q, %v", data, err)
+	}
+}
+
+func TestStartControlServerToken(t *testing.T) {
+	s, err := StartControlServer("127.0.0.1:0", &fakePlayer{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Token != "" {
+		t.Errorf("loopback server has token %q", s.Token)
+	}
+
+	s, err = StartControlServer(":0", &fakePlayer{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if len(s.Token) != 32 {
+		t.Errorf("network server token = %q", s.Token)
+	}
+}
+
+func TestStartControlServerRejectsRebinding(t *testing.T) {
+	s, err := StartControlServer("127.0.0.1:0", &fakePlayer{}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	address := s.listenAddr.String()
+	_, port, _ := net.SplitHostPort(address)
+	for host, want := range map[string]int{
+		address:             http.StatusOK,
+		"evil.test:" + port: http.StatusForbidden,
+	} {
+		req, err := http.NewRequest(http.MethodGet, "http://"+address+"/api/status", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+		req.Header.Set("Origin", "http://"+host)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Host %s: status = %d, want %d", host, resp.StatusCode, want)
+		}
+	}
+}
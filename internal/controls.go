@@ -0,0 +1,58 @@
+package internal
+
+// PlayerAction is a request to the playback loop made while mpv is running
+type PlayerAction string
+
+const (
+	ActionNextEpisode       PlayerAction = "next"
+	ActionPreviousEpisode   PlayerAction = "previous"
+	ActionMarkWatchedStop   PlayerAction = "mark-watched-stop"
+	ActionToggleAutoAdvance PlayerAction = "toggle-auto-advance"
+	ActionStop              PlayerAction = "stop"
+)
+
+const (
+	actionMessage = "octopus-action"
+	markMessage   = "octopus-mark"
+)
+
+// BindOctoKeys registers the configured octopus keys in the running mpv
+func BindOctoKeys(ipcSocketPath string, config *OctoConfig) error {
+	bindings := []struct {
+		key  string
+		args []string
+	}{
+		{config.KeyNextEpisode, []string{actionMessage, string(ActionNextEpisode)}},
+		{config.KeyPreviousEpisode, []string{actionMessage, string(ActionPreviousEpisode)}},
+		{config.KeyMarkWatched, []string{actionMessage, string(ActionMarkWatchedStop)}},
+		{config.KeyToggleAutoAdvance, []string{actionMessage, string(ActionToggleAutoAdvance)}},
+		{config.KeyMarkIntro, []string{markMessage, "intro"}},
+		{config.KeyMarkOutro, []string{markMessage, "outro"}},
+	}
+
+	for _, binding := range bindings {
+		if binding.key == "" {
+			continue
+		}
+		if err := MPVBindKey(ipcSocketPath, binding.key, binding.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseActionEvent extracts a player action from an mpv script-message event
+func ParseActionEvent(event MPVEvent) (PlayerAction, bool) {
+	if event.Event != "client-message" || len(event.Args) != 2 || event.Args[0] != actionMessage {
+		return "", false
+	}
+	return PlayerAction(event.Args[1]), true
+}
+
+// ParseMarkEvent extracts the marker kind ("intro" or "outro") from an mpv script-message event
+func ParseMarkEvent(event MPVEvent) (string, bool) {
+	if event.Event != "client-message" || len(event.Args) != 2 || event.Args[0] != markMessage {
+		return "", false
+	}
+	return event.Args[1], true
+}
@@ -1,105 +1,245 @@
 package internal
 
 import (
+	"database/sql"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 	"strconv"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
 )
 
-// Simplified struct without LastWatched
 type TVShow struct {
 	ID           string `json:"id"`           // Vadapav show directory ID
 	PlaybackTime int    `json:"playback_time"`// Current playback time
 	EpisodeID    string `json:"episode_id"`   // Current episode ID
+	SkipMarkers  map[int]SkipMarkers `json:"skip_markers"` // Recorded intro/outro ranges by season (0 = whole show)
+	LastWatched  int64  `json:"last_watched"` // Unix time progress was last saved
+	Speed        float64 `json:"speed"`       // Last used playback speed, 0 if never saved
+	AudioTrack    string `json:"audio_track"`    // Remembered audio track as "lang|title"
+	SubtitleTrack string `json:"subtitle_track"` // Remembered subtitle track as "lang|title", or "none"
+	TrackerID     string `json:"tracker_id"`     // Show ID on the scrobbling tracker, "none" to not scrobble
 }
 
-// Function to add or update a TV show entry
-func LocalUpdateShow(databaseFile string, show TVShow) error {
-	shows := LocalGetAllShows(os.ExpandEnv(databaseFile))
-	
-	// Find and update existing entry or add new one
-	updated := false
-	for i, s := range shows {
-		if s.ID == show.ID {
-			shows[i] = show
-			updated = true
-			break
-		}
+// Schema changes in order, a database at user_version n has had the first n applied
+var databaseMigrations = []string{
+	`CREATE TABLE shows (
+		id             TEXT PRIMARY KEY,
+		episode_id     TEXT NOT NULL DEFAULT '',
+		playback_time  INTEGER NOT NULL DEFAULT 0,
+		skip_markers   TEXT NOT NULL DEFAULT '',
+		last_watched   INTEGER NOT NULL DEFAULT 0,
+		speed          REAL NOT NULL DEFAULT 0,
+		audio_track    TEXT NOT NULL DEFAULT '',
+		subtitle_track TEXT NOT NULL DEFAULT '',
+		tracker_id     TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE episodes (
+		show_id       TEXT NOT NULL,
+		episode_id    TEXT NOT NULL,
+		playback_time INTEGER NOT NULL DEFAULT 0,
+		last_watched  INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (show_id, episode_id)
+	);
+	CREATE TABLE watch_events (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		type       TEXT NOT NULL,
+		time       INTEGER NOT NULL,
+		show_id    TEXT NOT NULL,
+		episode_id TEXT NOT NULL,
+		position   INTEGER NOT NULL DEFAULT 0,
+		duration   INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX watch_events_time ON watch_events (time);`,
+	`ALTER TABLE episodes ADD COLUMN duration INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE episodes ADD COLUMN watched INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE episodes ADD COLUMN watch_count INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE history (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		show_id        TEXT NOT NULL,
+		episode_id     TEXT NOT NULL,
+		started_at     INTEGER NOT NULL,
+		ended_at       INTEGER NOT NULL,
+		start_position INTEGER NOT NULL DEFAULT 0,
+		end_position   INTEGER NOT NULL DEFAULT 0,
+		speed          REAL NOT NULL DEFAULT 0,
+		completed      INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX history_ended_at ON history (ended_at);`,
+}
+
+// EpisodeState is what we know about one episode of a show
+type EpisodeState struct {
+	EpisodeID   string
+	Position    int   // Where playback was last saved
+	Duration    int   // 0 until the episode has been played
+	Watched     bool
+	WatchCount  int
+	LastWatched int64 // Unix time the episode was last played
+}
+
+// InProgress reports whether the episode was left partway through
+func (s EpisodeState) InProgress() bool {
+	return !s.Watched && s.Position > 0
+}
+
+// Marker is shown next to the episode in pickers, ✓ for watched and ◐ for started
+func (s EpisodeState) Marker() string {
+	switch {
+	case s.Watched:
+		return "✓ "
+	case s.InProgress():
+		return "◐ "
 	}
+	return ""
+}
 
-	if !updated {
-		shows = append(shows, show)
+var (
+	databasesMu sync.Mutex
+	databases   = make(map[string]*sql.DB)
+)
+
+// openDatabase returns the open database for a file, creating it or migrating an old CSV database on first use
+func openDatabase(databaseFile string) (*sql.DB, error) {
+	databaseFile = os.ExpandEnv(databaseFile)
+
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	if db, ok := databases[databaseFile]; ok {
+		return db, nil
 	}
 
-	// Write updated list back to file
-	file, err := os.Create(databaseFile)
+	// Another instance starting at the same time mustn't migrate or create the schema alongside us
+	lock, err := LockFile(databaseFile)
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	defer lock.Unlock()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	if err := migrateCSVDatabase(databaseFile); err != nil {
+		return nil, fmt.Errorf("error migrating CSV database: %w", err)
+	}
 
-	// Write header if file is new
-	if !updated && len(shows) == 1 {
-		header := []string{"ShowID", "EpisodeID", "PlaybackTime"}
-		if err := writer.Write(header); err != nil {
-			return fmt.Errorf("error writing header: %w", err)
-		}
+	db, err := createDatabase(databaseFile)
+	if err != nil {
+		return nil, err
 	}
+	databases[databaseFile] = db
+	return db, nil
+}
 
-	// Write all shows without LastWatched
-	for _, s := range shows {
-		record := []string{
-			s.ID,
-			s.EpisodeID,
-			strconv.Itoa(s.PlaybackTime),
-		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("error writing record: %w", err)
+// createDatabase opens a database file and brings its schema up to date. Other octopus instances
+// may use the same file: they wait on each other for up to busy_timeout, and transactions take
+// the write lock as they begin so a read-modify-write can't interleave with another's.
+func createDatabase(databaseFile string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", databaseFile+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	// One connection, so writes from the playback loop and the control server queue up instead of failing
+	db.SetMaxOpenConns(1)
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error reading database version: %w", err)
+	}
+	for ; version < len(databaseMigrations); version++ {
+		err := inTransaction(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(databaseMigrations[version]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+			return err
+		})
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error updating database schema to version %d: %w", version+1, err)
 		}
 	}
-	
-	return nil
+	return db, nil
 }
 
-// Function to get all TV shows from the database
-func LocalGetAllShows(databaseFile string) []TVShow {
-	var shows []TVShow
+// inTransaction runs fn in a transaction, committing if it succeeds
+func inTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	// Ensure the directory exists
-	dir := filepath.Dir(databaseFile)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		OctoOut(fmt.Sprintf("Error creating directory: %v", err))
-		return shows
+// migrateCSVDatabase converts a shows.db from before the SQLite store. The shows are imported
+// into a new database next to it, and the CSV is kept as a backup once that has succeeded.
+func migrateCSVDatabase(databaseFile string) error {
+	file, err := os.Open(databaseFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(file, header)
+	file.Close()
+	// Empty files were left behind by the CSV store, SQLite takes them as an empty database
+	if n == 0 || string(header[:n]) == "SQLite format 3\x00" {
+		return nil
 	}
 
-	// Open the file, create if it doesn't exist
-	file, err := os.OpenFile(databaseFile, os.O_RDONLY|os.O_CREATE, 0644)
+	shows, err := readCSVShows(databaseFile)
 	if err != nil {
-		OctoOut(fmt.Sprintf("Error opening or creating file: %v", err))
-		return shows
+		return err
 	}
-	defer file.Close()
 
-	// If the file was just created, return empty list
-	fileInfo, err := file.Stat()
+	tmpFile := databaseFile + ".migrating"
+	os.Remove(tmpFile)
+	db, err := createDatabase(tmpFile)
 	if err != nil {
-		OctoOut(fmt.Sprintf("Error getting file info: %v", err))
-		return shows
+		return err
 	}
-	if fileInfo.Size() == 0 {
-		return shows
+	err = inTransaction(db, func(tx *sql.Tx) error {
+		for _, show := range shows {
+			if err := saveShow(tx, show); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		os.Remove(tmpFile)
+		return err
 	}
 
+	if err := os.Rename(databaseFile, databaseFile+".csv.bak"); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, databaseFile)
+}
+
+// readCSVShows reads the CSV format shows.db used to be stored in
+func readCSVShows(databaseFile string) ([]TVShow, error) {
+	file, err := os.Open(databaseFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Older databases have fewer columns
 	records, err := reader.ReadAll()
 	if err != nil {
-		OctoOut(fmt.Sprintf("Error reading file: %v", err))
-		return shows
+		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
 	// Skip header row if it exists
@@ -108,15 +248,14 @@ func LocalGetAllShows(databaseFile string) []TVShow {
 		startIdx = 1
 	}
 
-	// Parse records
+	var shows []TVShow
 	for _, row := range records[startIdx:] {
 		show := parseShowRow(row)
 		if show != nil {
 			shows = append(shows, *show)
 		}
 	}
-
-	return shows
+	return shows, nil
 }
 
 // Function to parse a single row of show data
@@ -128,11 +267,185 @@ func parseShowRow(row []string) *TVShow {
 
 	playbackTime, _ := strconv.Atoi(row[2])
 
-	return &TVShow{
+	show := &TVShow{
 		ID:           row[0],
 		EpisodeID:    row[1],
 		PlaybackTime: playbackTime,
 	}
+	if len(row) > 3 {
+		show.SkipMarkers = DecodeSkipMarkers(row[3])
+	}
+	if len(row) > 4 {
+		show.LastWatched, _ = strconv.ParseInt(row[4], 10, 64)
+	}
+	if len(row) > 5 {
+		show.Speed, _ = strconv.ParseFloat(row[5], 64)
+	}
+	if len(row) > 7 {
+		show.AudioTrack = row[6]
+		show.SubtitleTrack = row[7]
+	}
+	if len(row) > 8 {
+		show.TrackerID = row[8]
+	}
+	return show
+}
+
+// saveShow writes a show and the progress of its current episode
+func saveShow(tx *sql.Tx, show TVShow) error {
+	_, err := tx.Exec(`INSERT INTO shows (id, episode_id, playback_time, skip_markers, last_watched, speed, audio_track, subtitle_track, tracker_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			episode_id = excluded.episode_id,
+			playback_time = excluded.playback_time,
+			skip_markers = excluded.skip_markers,
+			last_watched = excluded.last_watched,
+			speed = excluded.speed,
+			audio_track = excluded.audio_track,
+			subtitle_track = excluded.subtitle_track,
+			tracker_id = excluded.tracker_id`,
+		show.ID, show.EpisodeID, show.PlaybackTime, EncodeSkipMarkers(show.SkipMarkers), show.LastWatched,
+		show.Speed, show.AudioTrack, show.SubtitleTrack, show.TrackerID)
+	if err != nil {
+		return fmt.Errorf("error saving show: %w", err)
+	}
+	if show.EpisodeID == "" {
+		return nil
+	}
+
+	_, err = tx.Exec(`INSERT INTO episodes (show_id, episode_id, playback_time, last_watched)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (show_id, episode_id) DO UPDATE SET
+			playback_time = excluded.playback_time,
+			last_watched = excluded.last_watched`,
+		show.ID, show.EpisodeID, show.PlaybackTime, show.LastWatched)
+	if err != nil {
+		return fmt.Errorf("error saving episode: %w", err)
+	}
+	return nil
+}
+
+// Function to add or update a TV show entry
+func LocalUpdateShow(databaseFile string, show TVShow) error {
+	show.LastWatched = time.Now().Unix()
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		return err
+	}
+	return inTransaction(db, func(tx *sql.Tx) error {
+		return saveShow(tx, show)
+	})
+}
+
+// Function to get all TV shows from the database
+func LocalGetAllShows(databaseFile string) []TVShow {
+	var shows []TVShow
+
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		OctoOut(fmt.Sprintf("Error opening database: %v", err))
+		return shows
+	}
+
+	rows, err := db.Query(`SELECT id, episode_id, playback_time, skip_markers, last_watched, speed, audio_track, subtitle_track, tracker_id
+		FROM shows ORDER BY rowid`)
+	if err != nil {
+		OctoOut(fmt.Sprintf("Error reading database: %v", err))
+		return shows
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var show TVShow
+		var skipMarkers string
+		err := rows.Scan(&show.ID, &show.EpisodeID, &show.PlaybackTime, &skipMarkers, &show.LastWatched,
+			&show.Speed, &show.AudioTrack, &show.SubtitleTrack, &show.TrackerID)
+		if err != nil {
+			OctoOut(fmt.Sprintf("Error reading show: %v", err))
+			continue
+		}
+		show.SkipMarkers = DecodeSkipMarkers(skipMarkers)
+		shows = append(shows, show)
+	}
+	if err := rows.Err(); err != nil {
+		OctoOut(fmt.Sprintf("Error reading database: %v", err))
+	}
+
+	return shows
+}
+
+// LocalRecordEvent adds a playback event to the watch history and updates the episode's state
+func LocalRecordEvent(databaseFile string, event Event) error {
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		return err
+	}
+	return inTransaction(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO watch_events (type, time, show_id, episode_id, position, duration) VALUES (?, ?, ?, ?, ?, ?)`,
+			string(event.Type), event.Time, event.ShowID, event.EpisodeID, event.Position, event.Duration)
+		if err != nil {
+			return fmt.Errorf("error recording watch event: %w", err)
+		}
+
+		if event.Type == EventEpisodeCompleted {
+			_, err = tx.Exec(`INSERT INTO episodes (show_id, episode_id, playback_time, last_watched, duration, watched, watch_count)
+				VALUES (?, ?, ?, ?, ?, 1, 1)
+				ON CONFLICT (show_id, episode_id) DO UPDATE SET
+					last_watched = excluded.last_watched,
+					duration = max(duration, excluded.duration),
+					watched = 1,
+					watch_count = watch_count + 1`,
+				event.ShowID, event.EpisodeID, event.Position, event.Time, event.Duration)
+		}
+		if err != nil {
+			return fmt.Errorf("error updating episode: %w", err)
+		}
+		return nil
+	})
+}
+
+// LocalSetEpisodeDuration stores an episode's duration, called once the player knows it
+func LocalSetEpisodeDuration(databaseFile string, showID string, episodeID string, duration int) error {
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO episodes (show_id, episode_id, duration) VALUES (?, ?, ?)
+		ON CONFLICT (show_id, episode_id) DO UPDATE SET duration = excluded.duration`,
+		showID, episodeID, duration)
+	if err != nil {
+		return fmt.Errorf("error saving episode duration: %w", err)
+	}
+	return nil
+}
+
+// LocalGetEpisodeStates returns the episodes of a show we have a record of, by episode ID
+func LocalGetEpisodeStates(databaseFile string, showID string) map[string]EpisodeState {
+	states := make(map[string]EpisodeState)
+
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		OctoOut(fmt.Sprintf("Error opening database: %v", err))
+		return states
+	}
+
+	rows, err := db.Query(`SELECT episode_id, playback_time, duration, watched, watch_count, last_watched
+		FROM episodes WHERE show_id = ?`, showID)
+	if err != nil {
+		OctoOut(fmt.Sprintf("Error reading episodes: %v", err))
+		return states
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state EpisodeState
+		if err := rows.Scan(&state.EpisodeID, &state.Position, &state.Duration, &state.Watched, &state.WatchCount, &state.LastWatched); err != nil {
+			OctoOut(fmt.Sprintf("Error reading episode: %v", err))
+			continue
+		}
+		states[state.EpisodeID] = state
+	}
+	return states
 }
 
 // Function to find a show by ID
@@ -149,138 +462,75 @@ func LocalFindShow(shows []TVShow, showID string) *TVShow {
 func UpdateShowProgress(databaseFile string, showID string, episodeID string, playbackTime int) error {
 	shows := LocalGetAllShows(databaseFile)
 	show := LocalFindShow(shows, showID)
-	
+
 	if show == nil {
 		// New show
 		show = &TVShow{
 			ID: showID,
 		}
 	}
-	
+
 	show.EpisodeID = episodeID
 	show.PlaybackTime = playbackTime
-	
+
 	return LocalUpdateShow(databaseFile, *show)
 }
 
 // Function to delete a show by ID
 func LocalDeleteShow(databaseFile string, showID string) error {
-	shows := LocalGetAllShows(databaseFile)
-	
-	// Filter out the show with matching ID
-	var filteredShows []TVShow
-	found := false
-	for _, show := range shows {
-		if show.ID != showID {
-			filteredShows = append(filteredShows, show)
-		} else {
-			found = true
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("show with ID %s not found", showID)
-	}
-
-	// Write the filtered list back to file
-	file, err := os.Create(databaseFile)
+	db, err := openDatabase(databaseFile)
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write header
-	header := []string{"ShowID", "EpisodeID", "PlaybackTime"}
-	if err := writer.Write(header); err != nil {
-		return fmt.Errorf("error writing header: %w", err)
-	}
-
-	// Write remaining shows
-	for _, show := range filteredShows {
-		record := []string{
-			show.ID,
-			show.EpisodeID,
-			strconv.Itoa(show.PlaybackTime),
+	return inTransaction(db, func(tx *sql.Tx) error {
+		result, err := tx.Exec("DELETE FROM shows WHERE id = ?", showID)
+		if err != nil {
+			return fmt.Errorf("error deleting show: %w", err)
 		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("error writing record: %w", err)
+		if deleted, _ := result.RowsAffected(); deleted == 0 {
+			return fmt.Errorf("show with ID %s not found", showID)
 		}
-	}
-
-	return nil
+		if _, err := tx.Exec("DELETE FROM episodes WHERE show_id = ?", showID); err != nil {
+			return fmt.Errorf("error deleting episodes: %w", err)
+		}
+		return nil
+	})
 }
 
 // Function to delete multiple shows by IDs
 func LocalDeleteShows(databaseFile string, showIDs []string) error {
-	shows := LocalGetAllShows(databaseFile)
-	
-	// Create a map of IDs to delete for O(1) lookup
-	toDelete := make(map[string]bool)
-	for _, id := range showIDs {
-		toDelete[id] = true
-	}
-
-	// Filter out shows with matching IDs
-	var filteredShows []TVShow
-	for _, show := range shows {
-		if !toDelete[show.ID] {
-			filteredShows = append(filteredShows, show)
-		}
-	}
-
-	// Write the filtered list back to file
-	file, err := os.Create(databaseFile)
+	db, err := openDatabase(databaseFile)
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write header
-	header := []string{"ShowID", "EpisodeID", "PlaybackTime"}
-	if err := writer.Write(header); err != nil {
-		return fmt.Errorf("error writing header: %w", err)
+		return err
 	}
-
-	// Write remaining shows
-	for _, show := range filteredShows {
-		record := []string{
-			show.ID,
-			show.EpisodeID,
-			strconv.Itoa(show.PlaybackTime),
-		}
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("error writing record: %w", err)
+	return inTransaction(db, func(tx *sql.Tx) error {
+		for _, id := range showIDs {
+			if _, err := tx.Exec("DELETE FROM shows WHERE id = ?", id); err != nil {
+				return fmt.Errorf("error deleting show: %w", err)
+			}
+			if _, err := tx.Exec("DELETE FROM episodes WHERE show_id = ?", id); err != nil {
+				return fmt.Errorf("error deleting episodes: %w", err)
+			}
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
-// Function to clear all shows from the database
+// Function to clear all shows from the database, the watch history is kept
 func LocalClearShows(databaseFile string) error {
-	// Create empty file (clearing all content)
-	file, err := os.Create(databaseFile)
+	db, err := openDatabase(databaseFile)
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Write only the header
-	header := []string{"ShowID", "EpisodeID", "PlaybackTime"}
-	if err := writer.Write(header); err != nil {
-		return fmt.Errorf("error writing header: %w", err)
+		return err
 	}
-
-	return nil
+	return inTransaction(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM shows"); err != nil {
+			return fmt.Errorf("error clearing shows: %w", err)
+		}
+		if _, err := tx.Exec("DELETE FROM episodes"); err != nil {
+			return fmt.Errorf("error clearing episodes: %w", err)
+		}
+		return nil
+	})
 }
 
 // Function to get show name from ID
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEpisodeStateMarker(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      EpisodeState
+		inProgress bool
+		marker     string
+	}{
+		{"never played", EpisodeState{}, false, ""},
+		{"opened but not started", EpisodeState{Duration: 1440}, false, ""},
+		{"started", EpisodeState{Position: 300}, true, "◐ "},
+		{"watched", EpisodeState{Watched: true}, false, "✓ "},
+		{"watched and started again", EpisodeState{Position: 300, Watched: true}, false, "✓ "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.InProgress(); got != tt.inProgress {
+				t.Errorf("InProgress() = %v, want %v", got, tt.inProgress)
+			}
+			if got := tt.state.Marker(); got != tt.marker {
+				t.Errorf("Marker() = %q, want %q", got, tt.marker)
+			}
+		})
+	}
+}
+
+func TestLocalEpisodeStates(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "shows.db")
+
+	if err := LocalUpdateShow(databaseFile, TVShow{ID: "show", EpisodeID: "e1", PlaybackTime: 300}); err != nil {
+		t.Fatal(err)
+	}
+	// The player knows the duration a moment after the episode started
+	if err := LocalRecordEvent(databaseFile, Event{Type: EventEpisodeStart, Time: 100, ShowID: "show", EpisodeID: "e2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LocalSetEpisodeDuration(databaseFile, "show", "e2", 1420); err != nil {
+		t.Fatal(err)
+	}
+	if err := LocalSetEpisodeDuration(databaseFile, "show", "e1", 1440); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		completed := Event{Type: EventEpisodeCompleted, Time: 200, ShowID: "show", EpisodeID: "e3", Position: 1400, Duration: 1430}
+		if err := LocalRecordEvent(databaseFile, completed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := LocalSetEpisodeDuration(databaseFile, "other", "e1", 60); err != nil {
+		t.Fatal(err)
+	}
+
+	states := LocalGetEpisodeStates(databaseFile, "show")
+	want := map[string]EpisodeState{
+		"e1": {EpisodeID: "e1", Position: 300, Duration: 1440},
+		"e2": {EpisodeID: "e2", Duration: 1420},
+		"e3": {EpisodeID: "e3", Position: 1400, Duration: 1430, Watched: true, WatchCount: 2, LastWatched: 200},
+	}
+	if len(states) != len(want) {
+		t.Fatalf("states = %+v, want %+v", states, want)
+	}
+	for id, state := range want {
+		got := states[id]
+		if id == "e1" {
+			// Set to the time of the save
+			got.LastWatched = 0
+		}
+		if got != state {
+			t.Errorf("state %s = %+v, want %+v", id, got, state)
+		}
+	}
+}
+
+// closeDatabase forgets the open database, so the next use opens the file like a new octopus process
+func closeDatabase(t *testing.T, databaseFile string) {
+	t.Helper()
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	if db, ok := databases[databaseFile]; ok {
+		db.Close()
+		delete(databases, databaseFile)
+	}
+}
+
+func TestMigrateCSVDatabase(t *testing.T) {
+	rows := "show1,ep3,125,1:90-180/,1700000000,1.5,jpn|Japanese,none,trakt-1\n" +
+		"show2,ep1,0\n"
+	tests := []struct {
+		name string
+		csv  string
+	}{
+		{"with header", "ShowID,EpisodeID,PlaybackTime,SkipMarkers,LastWatched,Speed,AudioTrack,SubtitleTrack,TrackerID\n" + rows},
+		{"without header", rows},
+	}
+	want := []TVShow{
+		{ID: "show1", EpisodeID: "ep3", PlaybackTime: 125, SkipMarkers: map[int]SkipMarkers{1: {Intro: SkipRange{90, 180}}},
+			LastWatched: 1700000000, Speed: 1.5, AudioTrack: "jpn|Japanese", SubtitleTrack: "none", TrackerID: "trakt-1"},
+		{ID: "show2", EpisodeID: "ep1", SkipMarkers: map[int]SkipMarkers{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databaseFile := filepath.Join(t.TempDir(), "shows.db")
+			if err := os.WriteFile(databaseFile, []byte(tt.csv), 0644); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { closeDatabase(t, databaseFile) })
+
+			shows := LocalGetAllShows(databaseFile)
+			if !reflect.DeepEqual(shows, want) {
+				t.Errorf("shows = %+v, want %+v", shows, want)
+			}
+			backup, err := os.ReadFile(databaseFile + ".csv.bak")
+			if err != nil || string(backup) != tt.csv {
+				t.Errorf("backup = %q, %v, want the original CSV", backup, err)
+			}
+			if _, err := os.Stat(databaseFile + ".migrating"); !os.IsNotExist(err) {
+				t.Errorf("temporary database left behind: %v", err)
+			}
+			states := LocalGetEpisodeStates(databaseFile, "show1")
+			if states["ep3"].Position != 125 {
+				t.Errorf("episode progress = %+v, want the CSV position", states["ep3"])
+			}
+		})
+	}
+}
+
+func TestReopenMigratedDatabase(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "shows.db")
+	if err := os.WriteFile(databaseFile, []byte("show1,ep1,60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LocalUpdateShow(databaseFile, TVShow{ID: "show1", EpisodeID: "ep2", PlaybackTime: 30}); err != nil {
+		t.Fatal(err)
+	}
+	closeDatabase(t, databaseFile)
+
+	// A changed backup shows whether the CSV was imported again
+	if err := os.WriteFile(databaseFile+".csv.bak", []byte("show9,ep9,9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	shows := LocalGetAllShows(databaseFile)
+	t.Cleanup(func() { closeDatabase(t, databaseFile) })
+	if len(shows) != 1 || shows[0].ID != "show1" || shows[0].EpisodeID != "ep2" || shows[0].PlaybackTime != 30 {
+		t.Errorf("shows after reopening = %+v, want show1 at ep2 30s", shows)
+	}
+	if backup, _ := os.ReadFile(databaseFile + ".csv.bak"); string(backup) != "show9,ep9,9\n" {
+		t.Errorf("backup replaced on reopening: %q", backup)
+	}
+}
+
+func TestCreateDatabaseUpgradesSchema(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "shows.db")
+
+	// A database written by a version that only had the first schema
+	old, err := sql.Open("sqlite", databaseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		databaseMigrations[0],
+		"PRAGMA user_version = 1",
+		"INSERT INTO shows (id, episode_id, playback_time) VALUES ('show1', 'ep2', 75)",
+		"INSERT INTO episodes (show_id, episode_id, playback_time, last_watched) VALUES ('show1', 'ep2', 75, 1700000000)",
+	} {
+		if _, err := old.Exec(statement); err != nil {
+			old.Close()
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db, err := createDatabase(databaseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if version != len(databaseMigrations) {
+		t.Errorf("user_version = %d, want %d", version, len(databaseMigrations))
+	}
+
+	t.Cleanup(func() { closeDatabase(t, databaseFile) })
+	states := LocalGetEpisodeStates(databaseFile, "show1")
+	if want := (EpisodeState{EpisodeID: "ep2", Position: 75, LastWatched: 1700000000}); states["ep2"] != want {
+		t.Errorf("episode after upgrade = %+v, want %+v", states["ep2"], want)
+	}
+	id, err := LocalAddHistory(databaseFile, HistoryEntry{ShowID: "show1", EpisodeID: "ep2", StartedAt: 1700000100})
+	if err != nil || id == 0 {
+		t.Errorf("history table missing after upgrade: %d, %v", id, err)
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsName  = "org.freedesktop.Notifications"
+	notificationsPath  = dbus.ObjectPath("/org/freedesktop/Notifications")
+	notificationsIface = "org.freedesktop.Notifications"
+)
+
+// NotificationButton is an action button on a desktop notification, pressing it hands Action to the playback loop
+type NotificationButton struct {
+	Label  string
+	Action PlayerAction
+}
+
+// DesktopNotifications talks to the notification server over the session bus. Notifications
+// sent with the same key replace each other in place, and button presses come back on Actions.
+type DesktopNotifications struct {
+	conn *dbus.Conn
+	obj  dbus.BusObject
+	// Whether the server can show buttons at all
+	canActions bool
+	mu         sync.Mutex
+	ids        map[string]uint32
+	buttons    map[uint32][]NotificationButton
+}
+
+var (
+	desktopOnce    sync.Once
+	desktopNotify  *DesktopNotifications
+	desktopErr     error
+	desktopActions = make(chan PlayerAction, 8)
+)
+
+// Desktop returns the shared connection to the notification server, connecting on first use
+func Desktop() (*DesktopNotifications, error) {
+	desktopOnce.Do(func() {
+		conn, err := dbus.ConnectSessionBus()
+		if err != nil {
+			desktopErr = fmt.Errorf("failed to connect to session bus: %w", err)
+			return
+		}
+		desktopNotify, desktopErr = newDesktopNotifications(conn)
+		if desktopErr != nil {
+			conn.Close()
+		}
+	})
+	return desktopNotify, desktopErr
+}
+
+// NotificationActions receives the actions of pressed notification buttons
+func NotificationActions() <-chan PlayerAction {
+	return desktopActions
+}
+
+func newDesktopNotifications(conn *dbus.Conn) (*DesktopNotifications, error) {
+	d := &DesktopNotifications{
+		conn:    conn,
+		obj:     conn.Object(notificationsName, notificationsPath),
+		ids:     make(map[string]uint32),
+		buttons: make(map[uint32][]NotificationButton),
+	}
+
+	var capabilities []string
+	if err := d.obj.Call(notificationsIface+".GetCapabilities", 0).Store(&capabilities); err != nil {
+		return nil, fmt.Errorf("no notification server: %w", err)
+	}
+	for _, capability := range capabilities {
+		if capability == "actions" {
+			d.canActions = true
+		}
+	}
+
+	if err := conn.AddMatchSignal(dbus.WithMatchObjectPath(notificationsPath), dbus.WithMatchInterface(notificationsIface)); err != nil {
+		return nil, fmt.Errorf("failed to listen for notification signals: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go d.listen(signals)
+	return d, nil
+}
+
+// Notify shows a notification, replacing the last one sent with the same key. Buttons are
+// left out when the server can't show them.
+func (d *DesktopNotifications) Notify(key string, summary string, body string, buttons ...NotificationButton) error {
+	d.mu.Lock()
+	replaces := d.ids[key]
+	d.mu.Unlock()
+
+	actions := []string{}
+	if d.canActions {
+		for i, button := range buttons {
+			actions = append(actions, strconv.Itoa(i), button.Label)
+		}
+	} else {
+		buttons = nil
+	}
+
+	var id uint32
+	err := d.obj.Call(notificationsIface+".Notify", 0,
+		"Octopus", replaces, "", summary, body, actions, map[string]dbus.Variant{}, int32(-1),
+	).Store(&id)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.buttons, replaces)
+	d.ids[key] = id
+	if len(buttons) > 0 {
+		d.buttons[id] = buttons
+	}
+	return nil
+}
+
+// listen turns button presses on our notifications into actions, the signals arrive for every application's notifications
+func (d *DesktopNotifications) listen(signals chan *dbus.Signal) {
+	for signal := range signals {
+		if len(signal.Body) == 0 {
+			continue
+		}
+		id, ok := signal.Body[0].(uint32)
+		if !ok {
+			continue
+		}
+
+		switch signal.Name {
+		case notificationsIface + ".ActionInvoked":
+			if len(signal.Body) < 2 {
+				continue
+			}
+			key, _ := signal.Body[1].(string)
+			index, err := strconv.Atoi(key)
+			if err != nil {
+				continue
+			}
+			d.mu.Lock()
+			buttons := d.buttons[id]
+			d.mu.Unlock()
+			if index < 0 || index >= len(buttons) {
+				continue
+			}
+			select {
+			case desktopActions <- buttons[index].Action:
+			default:
+			}
+		case notificationsIface + ".NotificationClosed":
+			d.mu.Lock()
+			delete(d.buttons, id)
+			d.mu.Unlock()
+		}
+	}
+}
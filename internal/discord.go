@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	discordOpHandshake = 0
+	discordOpFrame     = 1
+	discordOpClose     = 2
+	// Discord allows a handful of activity updates per 20 seconds, later changes wait for the next tick
+	discordUpdateInterval = 5 * time.Second
+	discordRetryInterval  = 30 * time.Second
+)
+
+// DiscordPresence shows what is playing as the user's Discord activity through the local IPC socket
+type DiscordPresence struct {
+	ClientID    string
+	conn        net.Conn
+	lastAttempt time.Time
+	lastUpdate  time.Time
+	nonce       int
+	// What Discord currently shows, to only send changes
+	details  string
+	state    string
+	paused   bool
+	startsAt int64
+}
+
+// NewDiscordPresence connects lazily on the first update and again whenever Discord restarts
+func NewDiscordPresence(clientID string) *DiscordPresence {
+	return &DiscordPresence{ClientID: clientID}
+}
+
+// discordSocketPaths lists where Discord, its snap and its flatpak create discord-ipc-0..9
+func discordSocketPaths() []string {
+	var dirs []string
+	for _, env := range []string{"XDG_RUNTIME_DIR", "TMPDIR", "TMP", "TEMP"} {
+		if dir := os.Getenv(env); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	dirs = append(dirs, "/tmp")
+
+	var paths []string
+	for _, dir := range dirs {
+		for _, sub := range []string{"", "app/com.discordapp.Discord", "snap.discord"} {
+			for i := 0; i < 10; i++ {
+				paths = append(paths, filepath.Join(dir, sub, fmt.Sprintf("discord-ipc-%d", i)))
+			}
+		}
+	}
+	return paths
+}
+
+func (d *DiscordPresence) connect() error {
+	d.lastAttempt = time.Now()
+	for _, path := range discordSocketPaths() {
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err != nil {
+			continue
+		}
+		d.conn = conn
+		if err := d.send(discordOpHandshake, map[string]interface{}{"v": 1, "client_id": d.ClientID}); err != nil {
+			d.disconnect()
+			return err
+		}
+		// Wait for READY before sending activities
+		if _, err := d.receive(); err != nil {
+			d.disconnect()
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("discord is not running")
+}
+
+func (d *DiscordPresence) disconnect() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+	d.details, d.state, d.startsAt = "", "", 0
+}
+
+func (d *DiscordPresence) send(opcode uint32, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 8, 8+len(data))
+	binary.LittleEndian.PutUint32(frame[0:4], opcode)
+	binary.LittleEndian.PutUint32(frame[4:8], uint32(len(data)))
+	frame = append(frame, data...)
+
+	d.conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	_, err = d.conn.Write(frame)
+	return err
+}
+
+func (d *DiscordPresence) receive() (map[string]interface{}, error) {
+	d.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(d.conn, header); err != nil {
+		return nil, err
+	}
+	opcode := binary.LittleEndian.Uint32(header[0:4])
+	data := make([]byte, binary.LittleEndian.Uint32(header[4:8]))
+	if _, err := io.ReadFull(d.conn, data); err != nil {
+		return nil, err
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	if opcode == discordOpClose {
+		return nil, fmt.Errorf("discord closed the connection: %v", payload["message"])
+	}
+	if payload["evt"] == "ERROR" {
+		return nil, fmt.Errorf("discord error: %v", payload["data"])
+	}
+	return payload, nil
+}
+
+func (d *DiscordPresence) setActivity(activity interface{}) error {
+	d.nonce++
+	err := d.send(discordOpFrame, map[string]interface{}{
+		"cmd":   "SET_ACTIVITY",
+		"args":  map[string]interface{}{"pid": os.Getpid(), "activity": activity},
+		"nonce": strconv.Itoa(d.nonce),
+	})
+	if err == nil {
+		_, err = d.receive()
+	}
+	if err != nil {
+		d.disconnect()
+	}
+	return err
+}
+
+// Update shows details (the show) and state (the episode) with elapsed and remaining time while playing
+func (d *DiscordPresence) Update(details string, state string, position float64, duration float64, paused bool) error {
+	startsAt := time.Now().Unix() - int64(position)
+	// Playback drifting by a second or two doesn't need an update, seeks do
+	seeked := math.Abs(float64(startsAt-d.startsAt)) > 5
+	if d.conn != nil && details == d.details && state == d.state && paused == d.paused && (paused || !seeked) {
+		return nil
+	}
+	if time.Since(d.lastUpdate) < discordUpdateInterval {
+		return nil
+	}
+	if d.conn == nil {
+		if time.Since(d.lastAttempt) < discordRetryInterval {
+			return nil
+		}
+		if err := d.connect(); err != nil {
+			return err
+		}
+	}
+
+	activity := map[string]interface{}{
+		"details": details,
+		"state":   state,
+		"assets":  map[string]string{"large_image": "octopus", "large_text": "Octopus"},
+	}
+	if paused {
+		activity["state"] = state + " (paused)"
+	} else {
+		timestamps := map[string]int64{"start": startsAt}
+		if duration > 0 {
+			timestamps["end"] = startsAt + int64(duration)
+		}
+		activity["timestamps"] = timestamps
+	}
+	if err := d.setActivity(activity); err != nil {
+		return err
+	}
+
+	d.lastUpdate = time.Now()
+	d.details, d.state, d.paused, d.startsAt = details, state, paused, startsAt
+	return nil
+}
+
+// Clear removes the activity and closes the connection
+func (d *DiscordPresence) Clear() {
+	if d.conn == nil {
+		return
+	}
+	d.setActivity(nil)
+	d.disconnect()
+}
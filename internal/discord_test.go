@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type discordFrame struct {
+	opcode  uint32
+	payload map[string]interface{}
+}
+
+// fakeDiscord answers the IPC handshake and SET_ACTIVITY like the Discord client does
+type fakeDiscord struct {
+	listener net.Listener
+	frames   chan discordFrame
+	mu       sync.Mutex
+	conns    []net.Conn
+}
+
+func startFakeDiscord(t *testing.T) *fakeDiscord {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	listener, err := net.Listen("unix", filepath.Join(dir, "discord-ipc-0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeDiscord{listener: listener, frames: make(chan discordFrame, 16)}
+	t.Cleanup(func() { listener.Close(); f.closeConns() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeDiscord) serve(conn net.Conn) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		data := make([]byte, binary.LittleEndian.Uint32(header[4:8]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		frame := discordFrame{opcode: binary.LittleEndian.Uint32(header[0:4])}
+		json.Unmarshal(data, &frame.payload)
+		f.frames <- frame
+
+		reply := map[string]interface{}{"cmd": "DISPATCH", "evt": "READY"}
+		if frame.opcode == discordOpFrame {
+			reply = map[string]interface{}{"cmd": frame.payload["cmd"], "nonce": frame.payload["nonce"]}
+		}
+		out, _ := json.Marshal(reply)
+		response := make([]byte, 8, 8+len(out))
+		binary.LittleEndian.PutUint32(response[0:4], discordOpFrame)
+		binary.LittleEndian.PutUint32(response[4:8], uint32(len(out)))
+		conn.Write(append(response, out...))
+	}
+}
+
+func (f *fakeDiscord) closeConns() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeDiscord) next(t *testing.T) discordFrame {
+	t.Helper()
+	select {
+	case frame := <-f.frames:
+		return frame
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame from octopus")
+		return discordFrame{}
+	}
+}
+
+func (f *fakeDiscord) expectHandshake(t *testing.T) {
+	t.Helper()
+	frame := f.next(t)
+	if frame.opcode != discordOpHandshake || frame.payload["client_id"] != "1234" || frame.payload["v"] != 1.0 {
+		t.Fatalf("handshake = %+v", frame)
+	}
+}
+
+func (f *fakeDiscord) expectActivity(t *testing.T) map[string]interface{} {
+	t.Helper()
+	frame := f.next(t)
+	if frame.opcode != discordOpFrame || frame.payload["cmd"] != "SET_ACTIVITY" {
+		t.Fatalf("frame = %+v, want SET_ACTIVITY", frame)
+	}
+	args, _ := frame.payload["args"].(map[string]interface{})
+	activity, _ := args["activity"].(map[string]interface{})
+	return activity
+}
+
+func TestDiscordPresence(t *testing.T) {
+	discord := startFakeDiscord(t)
+	presence := NewDiscordPresence("1234")
+
+	if err := presence.Update("Show", "S01E01 - Pilot", 60, 1400, false); err != nil {
+		t.Fatal(err)
+	}
+	discord.expectHandshake(t)
+	activity := discord.expectActivity(t)
+	if activity["details"] != "Show" || activity["state"] != "S01E01 - Pilot" {
+		t.Errorf("activity = %v", activity)
+	}
+	timestamps, _ := activity["timestamps"].(map[string]interface{})
+	start, _ := timestamps["start"].(float64)
+	end, _ := timestamps["end"].(float64)
+	if end-start != 1400 {
+		t.Errorf("timestamps = %v, want the episode's duration apart", timestamps)
+	}
+
+	// Nothing changed, nothing is sent
+	if err := presence.Update("Show", "S01E01 - Pilot", 61, 1400, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pausing drops the timestamps, once the rate limit allows another update
+	presence.lastUpdate = time.Time{}
+	if err := presence.Update("Show", "S01E01 - Pilot", 61, 1400, true); err != nil {
+		t.Fatal(err)
+	}
+	activity = discord.expectActivity(t)
+	if activity["state"] != "S01E01 - Pilot (paused)" || activity["timestamps"] != nil {
+		t.Errorf("paused activity = %v", activity)
+	}
+
+	// Discord restarting closes the socket: the next update fails, a later one reconnects
+	discord.closeConns()
+	presence.lastUpdate = time.Time{}
+	if err := presence.Update("Show", "S01E02", 0, 1400, false); err == nil {
+		t.Fatal("update on a closed socket succeeded")
+	}
+	presence.lastAttempt, presence.lastUpdate = time.Time{}, time.Time{}
+	// Drain the frame that may have made it out before the socket was found closed
+	select {
+	case <-discord.frames:
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := presence.Update("Show", "S01E02", 0, 1400, false); err != nil {
+		t.Fatal(err)
+	}
+	discord.expectHandshake(t)
+	if activity := discord.expectActivity(t); activity["state"] != "S01E02" {
+		t.Errorf("activity after reconnecting = %v", activity)
+	}
+
+	// Clear removes the activity
+	presence.Clear()
+	frame := discord.next(t)
+	args, _ := frame.payload["args"].(map[string]interface{})
+	if frame.payload["cmd"] != "SET_ACTIVITY" || args["activity"] != nil {
+		t.Fatalf("clear sent %+v", frame)
+	}
+	if presence.conn != nil {
+		t.Error("connection kept after Clear")
+	}
+}
+
+func TestDiscordPresenceNotRunning(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("TMPDIR", t.TempDir())
+	presence := NewDiscordPresence("1234")
+	err := presence.Update("Show", "S01E01", 0, 1400, false)
+	if presence.conn != nil {
+		presence.Clear()
+		t.Skip("a Discord client is running on this machine")
+	}
+	if err == nil {
+		t.Fatal("no error without Discord")
+	}
+	// Nothing to clear, and no panic
+	presence.Clear()
+}
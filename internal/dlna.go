@@ -0,0 +1,419 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ssdpAddress          = "239.255.255.250:1900"
+	mediaRendererType    = "urn:schemas-upnp-org:device:MediaRenderer:1"
+	avTransportType      = "urn:schemas-upnp-org:service:AVTransport:1"
+	avTransportTypeShort = "urn:schemas-upnp-org:service:AVTransport:"
+)
+
+// upnpTimeout bounds every request to a device, tests shorten it
+var upnpTimeout = 5 * time.Second
+
+// Renderer is a UPnP MediaRenderer found on the network
+type Renderer struct {
+	Name        string
+	Location    string
+	ControlURL  string
+	ServiceType string
+}
+
+type upnpDevice struct {
+	FriendlyName string `xml:"friendlyName"`
+	Services     []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+type upnpRoot struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// DiscoverRenderers sends an SSDP search and collects the MediaRenderers that answer within timeout
+func DiscoverRenderers(timeout time.Duration) ([]Renderer, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	addr, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil, err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: " + mediaRendererType + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+		return nil, fmt.Errorf("failed to send SSDP search: %w", err)
+	}
+
+	var renderers []Renderer
+	seen := make(map[string]bool)
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Read deadline reached
+			break
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" || seen[location] {
+			continue
+		}
+		seen[location] = true
+
+		renderer, err := GetRenderer(location)
+		if err != nil {
+			continue
+		}
+		renderers = append(renderers, *renderer)
+	}
+
+	return renderers, nil
+}
+
+// GetRenderer reads a device description and finds its AVTransport service
+func GetRenderer(location string) (*Renderer, error) {
+	// A device that answers the search but never serves its description mustn't hold up discovery
+	client := http.Client{Timeout: upnpTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch device description: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	}
+
+	var root upnpRoot
+	if err := xml.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to decode device description: %w", err)
+	}
+
+	base := location
+	if root.URLBase != "" {
+		base = root.URLBase
+	}
+
+	devices := []upnpDevice{root.Device}
+	for len(devices) > 0 {
+		device := devices[0]
+		devices = append(devices[1:], device.Devices...)
+
+		for _, service := range device.Services {
+			if !strings.HasPrefix(service.ServiceType, avTransportTypeShort) {
+				continue
+			}
+			controlURL, err := resolveURL(base, service.ControlURL)
+			if err != nil {
+				return nil, err
+			}
+			return &Renderer{
+				Name:        device.FriendlyName,
+				Location:    location,
+				ControlURL:  controlURL,
+				ServiceType: service.ServiceType,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("device has no AVTransport service")
+}
+
+func resolveURL(base string, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+// call invokes an AVTransport action and returns the values of the response arguments
+func (r *Renderer) call(action string, args ...[2]string) (map[string]string, error) {
+	serviceType := r.ServiceType
+	if serviceType == "" {
+		serviceType = avTransportType
+	}
+
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s"><InstanceID>0</InstanceID>`, action, serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		xml.EscapeText(&body, []byte(arg[1]))
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequest(http.MethodPost, r.ControlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, serviceType, action))
+
+	client := http.Client{Timeout: upnpTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s failed with status code %d", action, resp.StatusCode)
+	}
+
+	// Collect the text of every leaf element, keyed by its local name
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var current string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s response: %w", action, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+		case xml.CharData:
+			if current != "" {
+				values[current] += string(t)
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+	return values, nil
+}
+
+func (r *Renderer) SetURI(mediaURL string) error {
+	_, err := r.call("SetAVTransportURI", [2]string{"CurrentURI", mediaURL}, [2]string{"CurrentURIMetaData", ""})
+	return err
+}
+
+func (r *Renderer) Play() error {
+	_, err := r.call("Play", [2]string{"Speed", "1"})
+	return err
+}
+
+func (r *Renderer) Pause() error {
+	_, err := r.call("Pause")
+	return err
+}
+
+func (r *Renderer) Stop() error {
+	_, err := r.call("Stop")
+	return err
+}
+
+func (r *Renderer) Seek(seconds int) error {
+	_, err := r.call("Seek", [2]string{"Unit", "REL_TIME"}, [2]string{"Target", formatUPnPTime(seconds)})
+	return err
+}
+
+// PositionInfo returns the position and duration of the current track in seconds
+func (r *Renderer) PositionInfo() (float64, float64, error) {
+	values, err := r.call("GetPositionInfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseUPnPTime(values["RelTime"]), parseUPnPTime(values["TrackDuration"]), nil
+}
+
+// TransportState returns e.g. PLAYING, PAUSED_PLAYBACK, STOPPED or NO_MEDIA_PRESENT
+func (r *Renderer) TransportState() (string, error) {
+	values, err := r.call("GetTransportInfo")
+	if err != nil {
+		return "", err
+	}
+	return values["CurrentTransportState"], nil
+}
+
+func formatUPnPTime(seconds int) string {
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+// parseUPnPTime parses H+:MM:SS[.F+], returning 0 for NOT_IMPLEMENTED and other junk
+func parseUPnPTime(value string) float64 {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	var seconds float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// DLNAPlayer casts episodes to a renderer. Renderers only hold one track, so the queued
+// episode is loaded by Entry once the current one has stopped.
+type DLNAPlayer struct {
+	Renderer Renderer
+	// Guards the queue state, the playback loop and the control server both drive the player
+	mu      sync.Mutex
+	queued  string
+	entry   int
+	started bool
+}
+
+// NewDLNAPlayer starts playing url on the renderer
+func NewDLNAPlayer(renderer Renderer, mediaURL string) (*DLNAPlayer, error) {
+	p := &DLNAPlayer{Renderer: renderer}
+	if err := p.load(mediaURL); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// load starts mediaURL, the caller holds mu
+func (p *DLNAPlayer) load(mediaURL string) error {
+	if err := p.Renderer.SetURI(mediaURL); err != nil {
+		return err
+	}
+	p.started = false
+	return p.Renderer.Play()
+}
+
+func (p *DLNAPlayer) Entry() (int, error) {
+	state, err := p.Renderer.TransportState()
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch state {
+	case "PLAYING", "PAUSED_PLAYBACK":
+		p.started = true
+	case "STOPPED", "NO_MEDIA_PRESENT":
+		if !p.started {
+			break
+		}
+		if p.queued == "" {
+			return 0, fmt.Errorf("playback stopped on %s", p.Renderer.Name)
+		}
+		if err := p.next(); err != nil {
+			return 0, err
+		}
+	}
+	return p.entry, nil
+}
+
+func (p *DLNAPlayer) Position() (float64, bool, error) {
+	position, _, err := p.Renderer.PositionInfo()
+	if err != nil {
+		return 0, false, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return position, p.started, nil
+}
+
+func (p *DLNAPlayer) Duration() (float64, error) {
+	_, duration, err := p.Renderer.PositionInfo()
+	return duration, err
+}
+
+func (p *DLNAPlayer) Paused() (bool, error) {
+	state, err := p.Renderer.TransportState()
+	return state == "PAUSED_PLAYBACK", err
+}
+
+func (p *DLNAPlayer) SetPaused(paused bool) error {
+	if paused {
+		return p.Renderer.Pause()
+	}
+	return p.Renderer.Play()
+}
+
+func (p *DLNAPlayer) Seek(seconds int) error {
+	return p.Renderer.Seek(seconds)
+}
+
+func (p *DLNAPlayer) Speed() (float64, error) {
+	return 0, nil
+}
+
+func (p *DLNAPlayer) SetSpeed(speed float64) error {
+	return ErrUnsupported
+}
+
+func (p *DLNAPlayer) ShowText(text string, duration time.Duration) error {
+	return ErrUnsupported
+}
+
+func (p *DLNAPlayer) Queue(mediaURL string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued = mediaURL
+	p.entry = 0
+	return nil
+}
+
+func (p *DLNAPlayer) Next() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next()
+}
+
+func (p *DLNAPlayer) next() error {
+	if p.queued == "" {
+		return fmt.Errorf("nothing queued")
+	}
+	mediaURL := p.queued
+	p.queued = ""
+	if err := p.load(mediaURL); err != nil {
+		return err
+	}
+	p.entry++
+	return nil
+}
+
+func (p *DLNAPlayer) Quit() error {
+	return p.Renderer.Stop()
+}
@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// avTransportStub is a renderer answering the AVTransport actions octopus uses
+type avTransportStub struct {
+	mu       sync.Mutex
+	calls    []string
+	uri      string
+	state    string
+	position string
+	target   string
+}
+
+var soapArgPattern = regexp.MustCompile(`<(CurrentURI|Target|Unit)>([^<]*)</`)
+
+func (a *avTransportStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	_, action, _ = strings.Cut(action, "#")
+	body, _ := io.ReadAll(r.Body)
+	args := make(map[string]string)
+	for _, match := range soapArgPattern.FindAllStringSubmatch(string(body), -1) {
+		args[match[1]] = match[2]
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, action)
+	response := ""
+	switch action {
+	case "SetAVTransportURI":
+		a.uri = args["CurrentURI"]
+		a.state = "STOPPED"
+	case "Play":
+		a.state = "PLAYING"
+	case "Pause":
+		a.state = "PAUSED_PLAYBACK"
+	case "Stop":
+		a.state = "STOPPED"
+	case "Seek":
+		a.target = args["Target"]
+		a.position = args["Target"]
+	case "GetPositionInfo":
+		response = fmt.Sprintf("<RelTime>%s</RelTime><TrackDuration>0:24:00</TrackDuration>", a.position)
+	case "GetTransportInfo":
+		response = fmt.Sprintf("<CurrentTransportState>%s</CurrentTransportState>", a.state)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+		`<u:%sResponse xmlns:u="%s">%s</u:%sResponse></s:Body></s:Envelope>`, action, avTransportType, response, action)
+}
+
+func (a *avTransportStub) setState(state string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.state = state
+}
+
+func (a *avTransportStub) current() (string, []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.uri, append([]string(nil), a.calls...)
+}
+
+func newTestRenderer(t *testing.T) (Renderer, *avTransportStub) {
+	t.Helper()
+	stub := &avTransportStub{state: "NO_MEDIA_PRESENT", position: "0:00:00"}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return Renderer{Name: "TV", ControlURL: server.URL + "/control", ServiceType: avTransportType}, stub
+}
+
+func TestGetRenderer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/description.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0"?><root xmlns="urn:schemas-upnp-org:device-1-0"><device>`+
+			`<friendlyName>Living Room</friendlyName><deviceList><device><friendlyName>Living Room Renderer</friendlyName>`+
+			`<serviceList><service><serviceType>urn:schemas-upnp-org:service:RenderingControl:1</serviceType><controlURL>/rc</controlURL></service>`+
+			`<service><serviceType>urn:schemas-upnp-org:service:AVTransport:2</serviceType><controlURL>/upnp/av</controlURL></service></serviceList>`+
+			`</device></deviceList></device></root>`)
+	})
+	mux.HandleFunc("/hangs.xml", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	renderer, err := GetRenderer(server.URL + "/description.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Renderer{
+		Name:        "Living Room Renderer",
+		Location:    server.URL + "/description.xml",
+		ControlURL:  server.URL + "/upnp/av",
+		ServiceType: "urn:schemas-upnp-org:service:AVTransport:2",
+	}
+	if *renderer != want {
+		t.Errorf("GetRenderer = %+v, want %+v", *renderer, want)
+	}
+
+	// A device that never answers gives up after the timeout
+	defer func(timeout time.Duration) { upnpTimeout = timeout }(upnpTimeout)
+	upnpTimeout = 100 * time.Millisecond
+	start := time.Now()
+	if _, err := GetRenderer(server.URL + "/hangs.xml"); err == nil {
+		t.Error("GetRenderer succeeded on a device that never answered")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("GetRenderer took %v", elapsed)
+	}
+}
+
+func TestParseUPnPTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"0:00:00", 0},
+		{"0:01:30", 90},
+		{"1:02:03", 3723},
+		{"10:00:00", 36000},
+		{"0:00:05.500", 5.5},
+		{" 0:00:10 ", 10},
+		{"NOT_IMPLEMENTED", 0},
+		{"1:30", 0},
+		{"", 0},
+		{"a:b:c", 0},
+	}
+	for _, tt := range tests {
+		if got := parseUPnPTime(tt.value); got != tt.want {
+			t.Errorf("parseUPnPTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormatUPnPTime(t *testing.T) {
+	for seconds, want := range map[int]string{0: "0:00:00", 90: "0:01:30", 3723: "1:02:03"} {
+		if got := formatUPnPTime(seconds); got != want {
+			t.Errorf("formatUPnPTime(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestRendererActions(t *testing.T) {
+	renderer, stub := newTestRenderer(t)
+
+	if err := renderer.SetURI("http://media/ep1.mkv?a=1&b=2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderer.Play(); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderer.Seek(3723); err != nil {
+		t.Fatal(err)
+	}
+	position, duration, err := renderer.PositionInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position != 3723 || duration != 1440 {
+		t.Errorf("PositionInfo() = %v, %v, want 3723, 1440", position, duration)
+	}
+	state, err := renderer.TransportState()
+	if err != nil || state != "PLAYING" {
+		t.Errorf("TransportState() = %q, %v", state, err)
+	}
+
+	uri, calls := stub.current()
+	if uri != "http://media/ep1.mkv?a=1&amp;b=2" {
+		t.Errorf("renderer got URI %q, want it XML-escaped", uri)
+	}
+	want := []string{"SetAVTransportURI", "Play", "Seek", "GetPositionInfo", "GetTransportInfo"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if stub.target != "1:02:03" {
+		t.Errorf("seek target = %q", stub.target)
+	}
+
+	if _, err := renderer.call("Unknown"); err == nil {
+		t.Error("expected an error for a failed action")
+	}
+}
+
+func TestDLNAPlayerQueue(t *testing.T) {
+	renderer, stub := newTestRenderer(t)
+	player, err := NewDLNAPlayer(renderer, "http://media/ep1.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopped before it ever played, e.g. still buffering: not the end of the episode
+	stub.setState("STOPPED")
+	if entry, err := player.Entry(); err != nil || entry != 0 {
+		t.Fatalf("Entry() while loading = %d, %v", entry, err)
+	}
+	if _, loaded, _ := player.Position(); loaded {
+		t.Error("Position reports loaded before playback started")
+	}
+
+	stub.setState("PLAYING")
+	if entry, err := player.Entry(); err != nil || entry != 0 {
+		t.Fatalf("Entry() while playing = %d, %v", entry, err)
+	}
+
+	// The episode ends with the next one queued: it is loaded and becomes entry 1
+	player.Queue("http://media/ep2.mkv")
+	stub.setState("STOPPED")
+	entry, err := player.Entry()
+	if err != nil || entry != 1 {
+		t.Fatalf("Entry() after the end = %d, %v", entry, err)
+	}
+	if uri, _ := stub.current(); uri != "http://media/ep2.mkv" {
+		t.Errorf("renderer plays %q, want ep2", uri)
+	}
+
+	// Nothing queued when it ends: playback is over
+	stub.setState("PLAYING")
+	player.Entry()
+	stub.setState("STOPPED")
+	if _, err := player.Entry(); err == nil {
+		t.Error("Entry() after the last episode should fail")
+	}
+
+	// Next starts the queued episode right away, and fails with nothing queued
+	player.Queue("http://media/ep3.mkv")
+	if err := player.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if uri, _ := stub.current(); uri != "http://media/ep3.mkv" {
+		t.Errorf("renderer plays %q, want ep3", uri)
+	}
+	if err := player.Next(); err == nil {
+		t.Error("Next() with nothing queued should fail")
+	}
+
+	// Queue from another goroutine, as the control server does, while the loop polls
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		player.Queue("http://media/ep4.mkv")
+	}()
+	player.Entry()
+	wg.Wait()
+}
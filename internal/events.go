@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType names a moment in a playback session that hooks and integrations can react to
+type EventType string
+
+const (
+	EventSessionStart     EventType = "session-start"
+	EventEpisodeStart     EventType = "episode-start"
+	EventEpisodeCompleted EventType = "episode-completed"
+	EventEpisodeStopped   EventType = "episode-stopped"
+	EventPaused           EventType = "paused"
+	EventResumed          EventType = "resumed"
+	EventShowFinished     EventType = "show-finished"
+	EventPlaybackError    EventType = "playback-error"
+	EventNewEpisode       EventType = "new-episode"
+	EventMessage          EventType = "message"
+)
+
+// Event describes what happened and to which episode
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      int64     `json:"time"`
+	ShowID    string    `json:"show_id"`
+	ShowName  string    `json:"show_name"`
+	EpisodeID string    `json:"episode_id"`
+	Episode   string    `json:"episode"`
+	Season    int       `json:"season"`
+	Number    int       `json:"number"`
+	Position  int       `json:"position"`
+	Duration  int       `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   []func(Event)
+)
+
+// NewEvent fills in an event for the show's current episode, details may be nil if they couldn't be fetched
+func NewEvent(eventType EventType, details *Show, show TVShow, duration int) Event {
+	event := Event{
+		Type:      eventType,
+		ShowID:    show.ID,
+		ShowName:  show.ID,
+		EpisodeID: show.EpisodeID,
+		Episode:   EpisodeTitle(details, show.EpisodeID),
+		Position:  show.PlaybackTime,
+		Duration:  duration,
+	}
+	if details != nil {
+		event.ShowName = details.Name
+	}
+	if episode := FindEpisode(details, show.EpisodeID); episode != nil {
+		event.Season = episode.Season
+		event.Number = episode.Episode
+	}
+	return event
+}
+
+// Subscribe registers a handler for every emitted event. Handlers run on the playback loop and must not block.
+func Subscribe(handler func(Event)) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers = append(subscribers, handler)
+}
+
+// Emit passes an event to every subscriber
+func Emit(event Event) {
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+
+	subscribersMu.Lock()
+	handlers := append([]func(Event){}, subscribers...)
+	subscribersMu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
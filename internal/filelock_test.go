@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config", "octopus.conf")
+	if err := WriteFileAtomic(path, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Fatalf("contents = %q, %v, want second", data, err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("permissions = %v, want 0600", info.Mode().Perm())
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the written one", len(entries))
+	}
+}
+
+func TestWriteFileAtomicFailureKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	// The name leaves no room for the temporary file's prefix and suffix, so writing fails before
+	// anything is replaced
+	path := filepath.Join(dir, strings.Repeat("a", 250))
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Skipf("file system doesn't take long names: %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte("replacement"), 0644); err == nil {
+		t.Fatal("write succeeded")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "original" {
+		t.Errorf("contents = %q, %v, want the original", data, err)
+	}
+
+	// Failing to put the new file in place removes it again
+	target := filepath.Join(dir, "state")
+	if err := os.MkdirAll(filepath.Join(target, "inside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(target, []byte("replacement"), 0644); err == nil {
+		t.Fatal("replaced a directory")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		t.Errorf("directory holds %v, want no temporary file left", names)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shows.db")
+	first, err := LockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *FileLock)
+	go func() {
+		second, err := LockFile(path)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second lock taken while the first is held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case second := <-acquired:
+		if second != nil {
+			second.Unlock()
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second lock not taken after the first was released")
+	}
+}
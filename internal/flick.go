@@ -6,9 +6,11 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -24,7 +26,68 @@ func RestoreScreen() {
     fmt.Print("\033[?1049l") // Switch back to the main screen buffer
 }
 
+var (
+	exitMu    sync.Mutex
+	exitHooks []func()
+	exiting   bool
+	// Set by ForwardSignals
+	forwardSignals chan os.Signal
+)
+
+// OnExit registers cleanup that ExitOcto runs before the process ends. Like deferred calls they
+// run last registered first, so waiting for background work comes after whatever queued it.
+func OnExit(hook func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks = append(exitHooks, hook)
+}
+
+// HandleSignals exits through ExitOcto on Ctrl+C, SIGTERM or SIGHUP so progress is saved
+// and the exit hooks run. Once a loop has called ForwardSignals they are passed on to it instead.
+func HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			exitMu.Lock()
+			forward := forwardSignals
+			exitMu.Unlock()
+			if forward == nil {
+				ExitOcto("", nil)
+			}
+			select {
+			case forward <- sig:
+			default:
+			}
+		}
+	}()
+}
+
+// ForwardSignals hands the signals HandleSignals catches to the caller, which then calls ExitOcto
+// itself. The playback loop uses it so the exit hooks don't touch its state from another goroutine.
+func ForwardSignals() <-chan os.Signal {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	if forwardSignals == nil {
+		forwardSignals = make(chan os.Signal, 1)
+	}
+	return forwardSignals
+}
+
 func ExitOcto(msg string, err error) {
+	exitMu.Lock()
+	if exiting {
+		// Already on the way out from another goroutine, which ends the process
+		exitMu.Unlock()
+		select {}
+	}
+	exiting = true
+	hooks := exitHooks
+	exitMu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
 	RestoreScreen()
 	OctoOut("Have a great day!")
 	if err != nil {
@@ -45,7 +108,9 @@ func ExitOcto(msg string, err error) {
 	os.Exit(0)
 }
 
-func OctoOut(data interface{}) {
+// OctoOut shows a message to the user, as a desktop notification in rofi mode or on the terminal.
+// Buttons are only offered on notifications, each message replaces the previous notification.
+func OctoOut(data interface{}, buttons ...NotificationButton) {
 	userOctoConfig := GetGlobalConfig()
 	if userOctoConfig == nil || userOctoConfig.StoragePath == "" {
 		var homeDir string
@@ -61,17 +126,31 @@ func OctoOut(data interface{}) {
 	userConfig := GetGlobalConfig()
 	dataStr := fmt.Sprintf("%v", data)
 	if userConfig.RofiSelection && runtime.GOOS != "windows" {
-		cmd := exec.Command("notify-send", dataStr)
-		err := cmd.Run()
+		desktop, err := Desktop()
+		if err == nil {
+			err = desktop.Notify("octopus", "Octopus", dataStr, buttons...)
+		}
 		if err != nil {
-			Log(fmt.Sprintf("%v", cmd), logFile)
 			Log(fmt.Sprintf("Failed to send notification: %v", err), logFile)
+			fmt.Println(data)
 		}
 	} else {
 		fmt.Println(data)
 	}
 }
 
+// OctoOSD shows a playback message on the video, falling back to OctoOut when the player can't display it
+func OctoOSD(player MediaPlayer, data interface{}) {
+	Emit(Event{Type: EventMessage, Message: fmt.Sprintf("%v", data)})
+	userConfig := GetGlobalConfig()
+	if userConfig.OsdMessages && player != nil {
+		if err := player.ShowText(fmt.Sprintf("%v", data), 3*time.Second); err == nil {
+			return
+		}
+	}
+	OctoOut(data)
+}
+
 // LogData logs the input data into a specified log file with the format [LOG] time lineNumber: logData
 func Log(data interface{}, logFile string) error {
 	// Open or create the log file
@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestForwardSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent to the own process on windows")
+	}
+	HandleSignals()
+	signals := ForwardSignals()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-signals:
+		if sig != syscall.SIGHUP {
+			t.Errorf("forwarded %v, want SIGHUP", sig)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("signal was not forwarded")
+	}
+}
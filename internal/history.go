@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// HistoryEntry is one stretch of watching an episode, from when it started playing until
+// playback moved on to another episode or stopped
+type HistoryEntry struct {
+	ID            int64
+	ShowID        string
+	EpisodeID     string
+	StartedAt     int64
+	EndedAt       int64
+	StartPosition int
+	EndPosition   int
+	Speed         float64 // 0 if the player couldn't report it
+	Completed     bool    // The episode counted as watched by the end
+}
+
+// LocalAddHistory appends an entry to the watch history when an episode starts and returns its ID.
+// The entry's end is kept current with LocalUpdateHistory while the episode plays.
+func LocalAddHistory(databaseFile string, entry HistoryEntry) (int64, error) {
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		return 0, err
+	}
+	if entry.EndedAt == 0 {
+		entry.EndedAt = entry.StartedAt
+		entry.EndPosition = entry.StartPosition
+	}
+	result, err := db.Exec(`INSERT INTO history (show_id, episode_id, started_at, ended_at, start_position, end_position, speed, completed)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.ShowID, entry.EpisodeID, entry.StartedAt, entry.EndedAt, entry.StartPosition, entry.EndPosition, entry.Speed, entry.Completed)
+	if err != nil {
+		return 0, fmt.Errorf("error adding to history: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// LocalUpdateHistory records how far an entry has got
+func LocalUpdateHistory(databaseFile string, entry HistoryEntry) error {
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE history SET ended_at = ?, end_position = ?, speed = ?, completed = ? WHERE id = ?`,
+		entry.EndedAt, entry.EndPosition, entry.Speed, entry.Completed, entry.ID)
+	if err != nil {
+		return fmt.Errorf("error updating history: %w", err)
+	}
+	return nil
+}
+
+// LocalGetHistory returns up to limit entries, most recent first
+func LocalGetHistory(databaseFile string, limit int) ([]HistoryEntry, error) {
+	db, err := openDatabase(databaseFile)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT id, show_id, episode_id, started_at, ended_at, start_position, end_position, speed, completed
+		FROM history ORDER BY ended_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var entry HistoryEntry
+		err := rows.Scan(&entry.ID, &entry.ShowID, &entry.EpisodeID, &entry.StartedAt, &entry.EndedAt,
+			&entry.StartPosition, &entry.EndPosition, &entry.Speed, &entry.Completed)
+		if err != nil {
+			return nil, fmt.Errorf("error reading history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// HistoryLabel describes an entry for the history menu, e.g. "2024-11-02 21:14  Show S01E02  03:10 → 22:41 ✓"
+func HistoryLabel(entry HistoryEntry, details *Show) string {
+	name := entry.ShowID
+	if details != nil {
+		name = details.Name
+	}
+	// Episodes the show no longer lists are shown by their ID
+	episode := EpisodeCode(details, entry.EpisodeID)
+	if episode == "" {
+		episode = entry.EpisodeID
+	}
+
+	label := fmt.Sprintf("%s  %s %s  %s → %s", time.Unix(entry.EndedAt, 0).Format("2006-01-02 15:04"), name, episode,
+		FormatTime(entry.StartPosition), FormatTime(entry.EndPosition))
+	if entry.Speed > 0 && entry.Speed != 1 {
+		label += fmt.Sprintf(" (%gx)", entry.Speed)
+	}
+	if entry.Completed {
+		label += " ✓"
+	}
+	return label
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryLabel(t *testing.T) {
+	details := &Show{Name: "Show", EpisodesList: []EpisodeEntry{{ID: "ep2", Season: 1, Episode: 2}}}
+	ended := time.Date(2024, 11, 2, 21, 14, 0, 0, time.Local).Unix()
+
+	tests := []struct {
+		name    string
+		entry   HistoryEntry
+		details *Show
+		want    string
+	}{
+		{"episode code", HistoryEntry{ShowID: "show", EpisodeID: "ep2", EndedAt: ended, StartPosition: 190, EndPosition: 1361},
+			details, "2024-11-02 21:14  Show S01E02  03:10 → 22:41"},
+		{"completed at a speed", HistoryEntry{ShowID: "show", EpisodeID: "ep2", EndedAt: ended, EndPosition: 1400, Speed: 1.5, Completed: true},
+			details, "2024-11-02 21:14  Show S01E02  00:00 → 23:20 (1.5x) ✓"},
+		{"normal speed isn't shown", HistoryEntry{ShowID: "show", EpisodeID: "ep2", EndedAt: ended, Speed: 1},
+			details, "2024-11-02 21:14  Show S01E02  00:00 → 00:00"},
+		{"episode no longer listed", HistoryEntry{ShowID: "show", EpisodeID: "ep9", EndedAt: ended, EndPosition: 60},
+			details, "2024-11-02 21:14  Show ep9  00:00 → 01:00"},
+		{"show details unavailable", HistoryEntry{ShowID: "show", EpisodeID: "ep2", EndedAt: ended, EndPosition: 60},
+			nil, "2024-11-02 21:14  show ep2  00:00 → 01:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HistoryLabel(tt.entry, tt.details); got != tt.want {
+				t.Errorf("HistoryLabel = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalHistory(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "shows.db")
+	t.Cleanup(func() { closeDatabase(t, databaseFile) })
+
+	// Rows are added when an episode starts and kept current as it plays
+	first, err := LocalAddHistory(databaseFile, HistoryEntry{ShowID: "show", EpisodeID: "ep1", StartedAt: 100, StartPosition: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LocalAddHistory(databaseFile, HistoryEntry{ShowID: "show", EpisodeID: "ep2", StartedAt: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := LocalAddHistory(databaseFile, HistoryEntry{ShowID: "other", EpisodeID: "ep1", StartedAt: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first episode was resumed in another window and went on the longest
+	if err := LocalUpdateHistory(databaseFile, HistoryEntry{ID: first, EndedAt: 500, EndPosition: 1400, Speed: 1.25, Completed: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LocalGetHistory(databaseFile, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HistoryEntry{
+		{ID: first, ShowID: "show", EpisodeID: "ep1", StartedAt: 100, EndedAt: 500, StartPosition: 30, EndPosition: 1400, Speed: 1.25, Completed: true},
+		// Ties go to the entry added last
+		{ID: other, ShowID: "other", EpisodeID: "ep1", StartedAt: 200, EndedAt: 200},
+		{ID: second, ShowID: "show", EpisodeID: "ep2", StartedAt: 200, EndedAt: 200},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("history = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	entries, err = LocalGetHistory(databaseFile, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != first {
+		t.Errorf("history limited to 1 = %+v, want the most recent entry", entries)
+	}
+}
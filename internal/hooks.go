@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HookRunner runs the user's scripts for events. A script named after the event, e.g.
+// episode-completed or episode-completed.sh, receives the event in OCTOPUS_* environment
+// variables and as JSON on stdin.
+type HookRunner struct {
+	Dir     string
+	Timeout time.Duration
+	LogFile string
+	wg      sync.WaitGroup
+}
+
+func NewHookRunner(dir string, timeout time.Duration, logFile string) *HookRunner {
+	return &HookRunner{Dir: dir, Timeout: timeout, LogFile: logFile}
+}
+
+// Handle starts the event's scripts in the background, so a slow hook can't hold up playback
+func (h *HookRunner) Handle(event Event) {
+	scripts := h.scripts(event.Type)
+	if len(scripts) == 0 {
+		return
+	}
+
+	input, err := json.Marshal(event)
+	if err != nil {
+		Log(fmt.Sprintf("Error encoding %s event: %v", event.Type, err), h.LogFile)
+		return
+	}
+	env := append(os.Environ(), hookEnv(event)...)
+
+	for _, script := range scripts {
+		h.wg.Add(1)
+		go func(script string) {
+			defer h.wg.Done()
+			h.run(script, input, env)
+		}(script)
+	}
+}
+
+// Wait lets running hooks finish before octopus exits, each is bounded by the timeout if there is one
+func (h *HookRunner) Wait() {
+	h.wg.Wait()
+}
+
+func (h *HookRunner) run(script string, input []byte, env []string) {
+	// A timeout of 0 or less lets hooks run as long as they like
+	ctx := context.Background()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	args := hookCommand(script, runtime.GOOS)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = h.Dir
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(input)
+	// Don't wait on pipes held open by anything the hook started in the background
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		Log(fmt.Sprintf("Hook %s timed out after %s", filepath.Base(script), h.Timeout), h.LogFile)
+		return
+	}
+	if err != nil {
+		Log(fmt.Sprintf("Hook %s failed: %v\n%s", filepath.Base(script), err, output), h.LogFile)
+		return
+	}
+	if len(output) > 0 {
+		Log(fmt.Sprintf("Hook %s: %s", filepath.Base(script), output), h.LogFile)
+	}
+}
+
+// scripts finds the executables in the hooks directory named after the event, with or without an extension
+func (h *HookRunner) scripts(eventType EventType) []string {
+	entries, err := os.ReadDir(h.Dir)
+	if err != nil {
+		return nil
+	}
+
+	var scripts []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.TrimSuffix(name, filepath.Ext(name)) != string(eventType) {
+			continue
+		}
+		// Stat follows symlinks to scripts kept elsewhere
+		path := filepath.Join(h.Dir, name)
+		info, err := os.Stat(path)
+		if err != nil || !hookRunnable(name, info.Mode(), runtime.GOOS) {
+			continue
+		}
+		scripts = append(scripts, path)
+	}
+	return scripts
+}
+
+// Windows has no executable bit, there the extension decides how a hook is run
+var windowsHookExtensions = map[string]bool{".exe": true, ".com": true, ".bat": true, ".cmd": true, ".ps1": true}
+
+func hookRunnable(name string, mode fs.FileMode, goos string) bool {
+	if !mode.IsRegular() {
+		return false
+	}
+	if goos == "windows" {
+		return windowsHookExtensions[strings.ToLower(filepath.Ext(name))]
+	}
+	return mode.Perm()&0111 != 0
+}
+
+// hookCommand returns the command line that runs script, PowerShell scripts go through powershell
+func hookCommand(script string, goos string) []string {
+	if goos == "windows" && strings.EqualFold(filepath.Ext(script), ".ps1") {
+		return []string{"powershell", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", script}
+	}
+	return []string{script}
+}
+
+func hookEnv(event Event) []string {
+	return []string{
+		"OCTOPUS_EVENT=" + string(event.Type),
+		"OCTOPUS_TIME=" + strconv.FormatInt(event.Time, 10),
+		"OCTOPUS_SHOW_ID=" + event.ShowID,
+		"OCTOPUS_SHOW_NAME=" + event.ShowName,
+		"OCTOPUS_EPISODE_ID=" + event.EpisodeID,
+		"OCTOPUS_EPISODE=" + event.Episode,
+		"OCTOPUS_SEASON=" + strconv.Itoa(event.Season),
+		"OCTOPUS_EPISODE_NUMBER=" + strconv.Itoa(event.Number),
+		"OCTOPUS_POSITION=" + strconv.Itoa(event.Position),
+		"OCTOPUS_DURATION=" + strconv.Itoa(event.Duration),
+		"OCTOPUS_ERROR=" + event.Error,
+		"OCTOPUS_MESSAGE=" + event.Message,
+	}
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookRunnable(t *testing.T) {
+	tests := []struct {
+		name string
+		mode fs.FileMode
+		goos string
+		want bool
+	}{
+		{"episode-completed", 0755, "linux", true},
+		{"episode-completed.sh", 0755, "darwin", true},
+		{"episode-completed.sh", 0644, "linux", false},
+		{"episode-completed", fs.ModeDir | 0755, "linux", false},
+		{"episode-completed.exe", 0666, "windows", true},
+		{"episode-completed.BAT", 0666, "windows", true},
+		{"episode-completed.cmd", 0666, "windows", true},
+		{"episode-completed.ps1", 0666, "windows", true},
+		{"episode-completed.sh", 0777, "windows", false},
+		{"episode-completed", 0666, "windows", false},
+		{"episode-completed.txt", 0666, "windows", false},
+	}
+	for _, tt := range tests {
+		if got := hookRunnable(tt.name, tt.mode, tt.goos); got != tt.want {
+			t.Errorf("hookRunnable(%q, %v, %s) = %v, want %v", tt.name, tt.mode, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestHookCommand(t *testing.T) {
+	tests := []struct {
+		script string
+		goos   string
+		want   []string
+	}{
+		{"/hooks/paused.sh", "linux", []string{"/hooks/paused.sh"}},
+		{`C:\hooks\paused.bat`, "windows", []string{`C:\hooks\paused.bat`}},
+		{`C:\hooks\paused.PS1`, "windows", []string{"powershell", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", `C:\hooks\paused.PS1`}},
+	}
+	for _, tt := range tests {
+		if got := hookCommand(tt.script, tt.goos); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hookCommand(%q, %s) = %q, want %q", tt.script, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestHookRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := "#!/bin/sh\necho \"$OCTOPUS_EVENT $OCTOPUS_EPISODE_NUMBER $(cat)\" > " + out + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "episode-completed.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Not executable, and named after another event
+	os.WriteFile(filepath.Join(dir, "episode-completed.txt"), []byte("nope"), 0644)
+	os.WriteFile(filepath.Join(dir, "episode-start.sh"), []byte("#!/bin/sh\ntouch "+out+".start\n"), 0755)
+
+	hooks := NewHookRunner(dir, 5*time.Second, filepath.Join(dir, "debug.log"))
+	hooks.Handle(Event{Type: EventEpisodeCompleted, ShowID: "show", Number: 3})
+	hooks.Wait()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "episode-completed 3 {") || !strings.Contains(string(data), `"show_id":"show"`) {
+		t.Errorf("hook output = %q", data)
+	}
+	if _, err := os.Stat(out + ".start"); !os.IsNotExist(err) {
+		t.Error("hook for another event ran")
+	}
+}
+
+func TestHookRunnerTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		finished bool
+	}{
+		{"no limit", 0, true},
+		{"negative means no limit", -time.Second, true},
+		{"within the limit", 5 * time.Second, true},
+		{"stopped at the limit", 100 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			out := filepath.Join(dir, "out")
+			script := "#!/bin/sh\nsleep 0.5\ntouch " + out + "\n"
+			if err := os.WriteFile(filepath.Join(dir, "paused.sh"), []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			hooks := NewHookRunner(dir, tt.timeout, filepath.Join(dir, "debug.log"))
+			hooks.Handle(Event{Type: EventPaused})
+			hooks.Wait()
+
+			_, err := os.Stat(out)
+			if finished := err == nil; finished != tt.finished {
+				t.Errorf("hook finished = %v, want %v", finished, tt.finished)
+			}
+		})
+	}
+}
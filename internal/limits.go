@@ -0,0 +1,50 @@
+package internal
+
+import "time"
+
+// SessionLimits enforces the sleep timer and binge limits for one octopus run
+type SessionLimits struct {
+	Deadline           time.Time
+	MaxEpisodes        int
+	StillWatchingAfter int
+	episodes           int
+	consecutive        int
+}
+
+// NewSessionLimits creates limits for a session starting now; zero values disable a limit
+func NewSessionLimits(sleep time.Duration, maxEpisodes int, stillWatchingAfter int) *SessionLimits {
+	limits := &SessionLimits{
+		MaxEpisodes:        maxEpisodes,
+		StillWatchingAfter: stillWatchingAfter,
+	}
+	if sleep > 0 {
+		limits.Deadline = time.Now().Add(sleep)
+	}
+	return limits
+}
+
+// EpisodeStarted counts a new episode and reports whether to ask "Are you still watching?"
+func (l *SessionLimits) EpisodeStarted(autoAdvanced bool) bool {
+	l.episodes++
+	if !autoAdvanced {
+		l.consecutive = 0
+		return false
+	}
+	l.consecutive++
+	return l.StillWatchingAfter > 0 && l.consecutive >= l.StillWatchingAfter
+}
+
+// Confirmed resets the auto-advance streak after the viewer interacts with the player
+func (l *SessionLimits) Confirmed() {
+	l.consecutive = 0
+}
+
+// CanAdvance reports whether another episode may be started automatically
+func (l *SessionLimits) CanAdvance() bool {
+	return l.MaxEpisodes <= 0 || l.episodes < l.MaxEpisodes
+}
+
+// SleepReached reports whether the sleep timer has run out
+func (l *SessionLimits) SleepReached(now time.Time) bool {
+	return !l.Deadline.IsZero() && !now.Before(l.Deadline)
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionLimitsMaxEpisodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxEpisodes int
+		started     int
+		want        bool
+	}{
+		{"no limit", 0, 10, true},
+		{"below the limit", 3, 2, true},
+		{"limit reached", 3, 3, false},
+		{"past the limit", 1, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := NewSessionLimits(0, tt.maxEpisodes, 0)
+			for i := 0; i < tt.started; i++ {
+				limits.EpisodeStarted(i > 0)
+			}
+			if got := limits.CanAdvance(); got != tt.want {
+				t.Errorf("CanAdvance() after %d episodes = %v, want %v", tt.started, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionLimitsStillWatching(t *testing.T) {
+	// Episodes started by hand (false) or by auto-advance (true), and whether each should ask
+	tests := []struct {
+		name       string
+		after      int
+		advances   []bool
+		wantPrompt []bool
+	}{
+		{"never asks", 0, []bool{false, true, true, true}, []bool{false, false, false, false}},
+		{"asks after the streak", 2, []bool{false, true, true, true}, []bool{false, false, true, true}},
+		{"picking an episode resets the streak", 2, []bool{true, false, true, true}, []bool{false, false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := NewSessionLimits(0, 0, tt.after)
+			for i, autoAdvanced := range tt.advances {
+				if got := limits.EpisodeStarted(autoAdvanced); got != tt.wantPrompt[i] {
+					t.Errorf("episode %d: prompt = %v, want %v", i+1, got, tt.wantPrompt[i])
+				}
+			}
+		})
+	}
+
+	// Answering the prompt starts a new streak
+	limits := NewSessionLimits(0, 0, 2)
+	limits.EpisodeStarted(true)
+	if !limits.EpisodeStarted(true) {
+		t.Fatal("no prompt after two auto-advanced episodes")
+	}
+	limits.Confirmed()
+	if limits.EpisodeStarted(true) {
+		t.Error("prompted again right after confirming")
+	}
+}
+
+func TestSessionLimitsSleep(t *testing.T) {
+	if NewSessionLimits(0, 0, 0).SleepReached(time.Now().Add(24 * time.Hour)) {
+		t.Error("sleep reached without a sleep timer")
+	}
+	limits := NewSessionLimits(45*time.Minute, 0, 0)
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{limits.Deadline.Add(-time.Second), false},
+		{limits.Deadline, true},
+		{limits.Deadline.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		if got := limits.SleepReached(tt.at); got != tt.want {
+			t.Errorf("SleepReached(deadline%+v) = %v, want %v", tt.at.Sub(limits.Deadline), got, tt.want)
+		}
+	}
+}
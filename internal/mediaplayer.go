@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"time"
+)
+
+// MediaPlayer is what the playback loop drives: mpv on this machine or a renderer on the network.
+// Players keep a queue of at most one entry after the current one, like mpv's playlist after
+// playlist-clear, so Entry is 0 for the current episode and 1 once the queued one has started.
+type MediaPlayer interface {
+	// Entry returns the index of the playing queue entry; an error means the player has closed
+	Entry() (int, error)
+	// Position returns the playback position in seconds, false while nothing is loaded yet
+	Position() (float64, bool, error)
+	Duration() (float64, error)
+	Paused() (bool, error)
+	SetPaused(paused bool) error
+	Seek(seconds int) error
+	// Speed returns the playback speed, 0 if the player can't report it
+	Speed() (float64, error)
+	SetSpeed(speed float64) error
+	ShowText(text string, duration time.Duration) error
+	// Queue replaces whatever plays after the current entry with url, an empty url clears it
+	Queue(url string) error
+	// Next starts the queued entry right away
+	Next() error
+	Quit() error
+}
+
+// ErrUnsupported is returned by players that lack a feature, e.g. on-screen text on a TV
+var ErrUnsupported = errors.New("not supported by this player")
+
+// MPVPlayer controls a local mpv through its IPC socket
+type MPVPlayer struct {
+	SocketPath string
+}
+
+// NewMPVPlayer starts mpv with url and returns a player for it, see PlayWithMPV
+func NewMPVPlayer(url string, audioOnly bool, args ...string) (*MPVPlayer, error) {
+	socketPath, err := PlayWithMPV(url, audioOnly, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &MPVPlayer{SocketPath: socketPath}, nil
+}
+
+func (p *MPVPlayer) Entry() (int, error) {
+	pos, err := MPVSendCommand(p.SocketPath, []interface{}{"get_property", "playlist-pos"})
+	if err != nil {
+		return 0, err
+	}
+	entry, _ := pos.(float64)
+	return int(entry), nil
+}
+
+func (p *MPVPlayer) Position() (float64, bool, error) {
+	timePos, err := MPVSendCommand(p.SocketPath, []interface{}{"get_property", "time-pos"})
+	if err != nil {
+		return 0, false, err
+	}
+	position, ok := timePos.(float64)
+	return position, ok, nil
+}
+
+func (p *MPVPlayer) Duration() (float64, error) {
+	duration, err := MPVSendCommand(p.SocketPath, []interface{}{"get_property", "duration"})
+	if err != nil {
+		return 0, err
+	}
+	seconds, _ := duration.(float64)
+	return seconds, nil
+}
+
+func (p *MPVPlayer) Paused() (bool, error) {
+	return GetMPVPausedStatus(p.SocketPath)
+}
+
+func (p *MPVPlayer) SetPaused(paused bool) error {
+	_, err := MPVSendCommand(p.SocketPath, []interface{}{"set_property", "pause", paused})
+	return err
+}
+
+func (p *MPVPlayer) Seek(seconds int) error {
+	_, err := SeekMPV(p.SocketPath, seconds)
+	return err
+}
+
+func (p *MPVPlayer) Speed() (float64, error) {
+	return GetMPVPlaybackSpeed(p.SocketPath)
+}
+
+func (p *MPVPlayer) SetSpeed(speed float64) error {
+	_, err := MPVSendCommand(p.SocketPath, []interface{}{"set_property", "speed", speed})
+	return err
+}
+
+func (p *MPVPlayer) ShowText(text string, duration time.Duration) error {
+	return MPVShowText(p.SocketPath, text, duration)
+}
+
+func (p *MPVPlayer) Queue(url string) error {
+	if err := MPVClearPlaylist(p.SocketPath); err != nil {
+		return err
+	}
+	if url == "" {
+		return nil
+	}
+	return MPVAppendToPlaylist(p.SocketPath, url)
+}
+
+func (p *MPVPlayer) Next() error {
+	return MPVPlaylistNext(p.SocketPath)
+}
+
+func (p *MPVPlayer) Quit() error {
+	_, err := MPVSendCommand(p.SocketPath, []interface{}{"quit"})
+	return err
+}
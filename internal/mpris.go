@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	mprisName        = "org.mpris.MediaPlayer2.octopus"
+	mprisPath        = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	mprisRootIface   = "org.mpris.MediaPlayer2"
+	mprisPlayerIface = "org.mpris.MediaPlayer2.Player"
+)
+
+var trackIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// MPRIS publishes the session on the D-Bus session bus, so media keys, KDE Connect and desktop
+// media widgets can control it. Like the control API, pausing and seeking go straight to the
+// player while episode changes and stopping are handed to the playback loop through Actions.
+type MPRIS struct {
+	Player  MediaPlayer
+	conn    *dbus.Conn
+	props   *prop.Properties
+	actions chan PlayerAction
+	mu      sync.Mutex
+	trackID dbus.ObjectPath
+	length  int64
+}
+
+// StartMPRIS connects to the session bus and registers org.mpris.MediaPlayer2.octopus
+func StartMPRIS(player MediaPlayer) (*MPRIS, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	m, err := newMPRIS(conn, player)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func newMPRIS(conn *dbus.Conn, player MediaPlayer) (*MPRIS, error) {
+	m := &MPRIS{
+		Player:  player,
+		conn:    conn,
+		actions: make(chan PlayerAction, 8),
+		trackID: "/org/mpris/MediaPlayer2/TrackList/NoTrack",
+	}
+
+	if err := conn.Export(mprisRoot{m}, mprisPath, mprisRootIface); err != nil {
+		return nil, fmt.Errorf("failed to export MPRIS interface: %w", err)
+	}
+	// Seek is exported as SeekBy on the Go side, as vet reserves the name for io.Seeker
+	if err := conn.ExportWithMap(mprisPlayer{m}, map[string]string{"SeekBy": "Seek"}, mprisPath, mprisPlayerIface); err != nil {
+		return nil, fmt.Errorf("failed to export MPRIS player interface: %w", err)
+	}
+
+	constant := func(value interface{}) *prop.Prop {
+		return &prop.Prop{Value: value, Emit: prop.EmitConst}
+	}
+	props, err := prop.Export(conn, mprisPath, prop.Map{
+		mprisRootIface: {
+			"CanQuit":             constant(true),
+			"CanRaise":            constant(false),
+			"HasTrackList":        constant(false),
+			"Identity":            constant("Octopus"),
+			"SupportedUriSchemes": constant([]string{}),
+			"SupportedMimeTypes":  constant([]string{}),
+		},
+		mprisPlayerIface: {
+			"PlaybackStatus": {Value: "Playing", Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Writable: true, Emit: prop.EmitTrue, Callback: m.setRate},
+			"Metadata":       {Value: map[string]dbus.Variant{"mpris:trackid": dbus.MakeVariant(m.trackID)}, Emit: prop.EmitTrue},
+			"Volume":         constant(1.0),
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"MinimumRate":    constant(0.25),
+			"MaximumRate":    constant(4.0),
+			"CanGoNext":      constant(true),
+			"CanGoPrevious":  constant(true),
+			"CanPlay":        constant(true),
+			"CanPause":       constant(true),
+			"CanSeek":        constant(true),
+			"CanControl":     constant(true),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export MPRIS properties: %w", err)
+	}
+	m.props = props
+
+	playerMethods := introspect.Methods(mprisPlayer{m})
+	for i := range playerMethods {
+		if playerMethods[i].Name == "SeekBy" {
+			playerMethods[i].Name = "Seek"
+		}
+	}
+	node := &introspect.Node{
+		Name: string(mprisPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       mprisRootIface,
+				Methods:    introspect.Methods(mprisRoot{m}),
+				Properties: props.Introspection(mprisRootIface),
+			},
+			{
+				Name:       mprisPlayerIface,
+				Methods:    playerMethods,
+				Properties: props.Introspection(mprisPlayerIface),
+				Signals: []introspect.Signal{
+					{Name: "Seeked", Args: []introspect.Arg{{Name: "Position", Type: "x"}}},
+				},
+			},
+		},
+	}
+	if err := conn.Export(introspect.NewIntrospectable(node), mprisPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return nil, fmt.Errorf("failed to export MPRIS introspection: %w", err)
+	}
+
+	reply, err := conn.RequestName(mprisName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request %s: %w", mprisName, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return nil, fmt.Errorf("%s is already taken by another octopus", mprisName)
+	}
+	return m, nil
+}
+
+// Actions returns the requests the playback loop has to carry out
+func (m *MPRIS) Actions() <-chan PlayerAction {
+	return m.actions
+}
+
+// Update publishes the playing episode and the player's state, once per playback loop tick
+func (m *MPRIS) Update(status SessionStatus, showName string) {
+	trackID := dbus.ObjectPath("/org/mpris/MediaPlayer2/octopus/episode/" + trackIDUnsafe.ReplaceAllString(status.EpisodeID, "_"))
+	length := int64(status.Duration * 1e6)
+	m.mu.Lock()
+	changed := trackID != m.trackID || length != m.length
+	m.trackID, m.length = trackID, length
+	m.mu.Unlock()
+
+	if changed {
+		m.props.SetMust(mprisPlayerIface, "Metadata", map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(trackID),
+			"mpris:length":  dbus.MakeVariant(length),
+			"xesam:title":   dbus.MakeVariant(status.Episode),
+			"xesam:album":   dbus.MakeVariant(showName),
+		})
+	}
+
+	playbackStatus := "Playing"
+	if status.Paused {
+		playbackStatus = "Paused"
+	}
+	if m.props.GetMust(mprisPlayerIface, "PlaybackStatus") != playbackStatus {
+		m.props.SetMust(mprisPlayerIface, "PlaybackStatus", playbackStatus)
+	}
+	if status.Speed > 0 && m.props.GetMust(mprisPlayerIface, "Rate") != status.Speed {
+		m.props.SetMust(mprisPlayerIface, "Rate", status.Speed)
+	}
+	m.props.SetMust(mprisPlayerIface, "Position", int64(status.Position*1e6))
+}
+
+// Close releases the bus name so desktop widgets drop octopus
+func (m *MPRIS) Close() {
+	m.conn.ReleaseName(mprisName)
+	m.conn.Close()
+}
+
+func (m *MPRIS) queueAction(action PlayerAction) *dbus.Error {
+	select {
+	case m.actions <- action:
+		return nil
+	default:
+		return dbus.MakeFailedError(fmt.Errorf("too many pending requests"))
+	}
+}
+
+func (m *MPRIS) seekTo(seconds float64) *dbus.Error {
+	if seconds < 0 {
+		seconds = 0
+	}
+	if err := m.Player.Seek(int(seconds)); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	m.props.SetMust(mprisPlayerIface, "Position", int64(seconds*1e6))
+	m.conn.Emit(mprisPath, mprisPlayerIface+".Seeked", int64(seconds*1e6))
+	return nil
+}
+
+func (m *MPRIS) setRate(change *prop.Change) *dbus.Error {
+	rate, ok := change.Value.(float64)
+	if !ok || rate <= 0 {
+		return dbus.MakeFailedError(fmt.Errorf("invalid rate"))
+	}
+	if err := m.Player.SetSpeed(rate); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// mprisRoot implements org.mpris.MediaPlayer2
+type mprisRoot struct{ m *MPRIS }
+
+func (r mprisRoot) Raise() *dbus.Error {
+	return nil
+}
+
+func (r mprisRoot) Quit() *dbus.Error {
+	return r.m.queueAction(ActionStop)
+}
+
+// mprisPlayer implements org.mpris.MediaPlayer2.Player
+type mprisPlayer struct{ m *MPRIS }
+
+func (p mprisPlayer) Next() *dbus.Error {
+	return p.m.queueAction(ActionNextEpisode)
+}
+
+func (p mprisPlayer) Previous() *dbus.Error {
+	return p.m.queueAction(ActionPreviousEpisode)
+}
+
+func (p mprisPlayer) Stop() *dbus.Error {
+	return p.m.queueAction(ActionStop)
+}
+
+func (p mprisPlayer) Play() *dbus.Error {
+	return p.setPaused(false)
+}
+
+func (p mprisPlayer) Pause() *dbus.Error {
+	return p.setPaused(true)
+}
+
+func (p mprisPlayer) PlayPause() *dbus.Error {
+	paused, err := p.m.Player.Paused()
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return p.setPaused(!paused)
+}
+
+func (p mprisPlayer) setPaused(paused bool) *dbus.Error {
+	if err := p.m.Player.SetPaused(paused); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	status := "Playing"
+	if paused {
+		status = "Paused"
+	}
+	p.m.props.SetMust(mprisPlayerIface, "PlaybackStatus", status)
+	return nil
+}
+
+// SeekBy moves by offset microseconds
+func (p mprisPlayer) SeekBy(offset int64) *dbus.Error {
+	position, _, err := p.m.Player.Position()
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return p.m.seekTo(position + float64(offset)/1e6)
+}
+
+// SetPosition jumps to position microseconds, ignored if the track has changed since the caller looked
+func (p mprisPlayer) SetPosition(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	p.m.mu.Lock()
+	current := p.m.trackID
+	p.m.mu.Unlock()
+	if trackID != current {
+		return nil
+	}
+	return p.m.seekTo(float64(position) / 1e6)
+}
+
+func (p mprisPlayer) OpenUri(uri string) *dbus.Error {
+	return dbus.MakeFailedError(ErrUnsupported)
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// privateBus starts a dbus-daemon for the test and returns its address
+func privateBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connectBus(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestMPRIS(t *testing.T) {
+	address := privateBus(t)
+	player := &fakePlayer{position: 100, speed: 1}
+	m, err := newMPRIS(connectBus(t, address), player)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Update(SessionStatus{EpisodeID: "ep/1", Episode: "Pilot", Position: 100, Duration: 1400, Speed: 1}, "Show")
+
+	client := connectBus(t, address)
+	object := client.Object(mprisName, mprisPath)
+	call := func(method string, args ...interface{}) {
+		t.Helper()
+		if err := object.Call(mprisPlayerIface+"."+method, 0, args...).Err; err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+	}
+	property := func(name string) interface{} {
+		t.Helper()
+		value, err := object.GetProperty(mprisPlayerIface + "." + name)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		return value.Value()
+	}
+
+	call("PlayPause")
+	if _, paused, _ := player.snapshot(); !paused || property("PlaybackStatus") != "Paused" {
+		t.Fatalf("PlayPause: paused = %v, status %v", paused, property("PlaybackStatus"))
+	}
+	call("PlayPause")
+	if _, paused, _ := player.snapshot(); paused || property("PlaybackStatus") != "Playing" {
+		t.Fatalf("second PlayPause: paused = %v, status %v", paused, property("PlaybackStatus"))
+	}
+
+	call("Seek", int64(30e6))
+	if position, _, _ := player.snapshot(); position != 130 {
+		t.Fatalf("Seek +30s: position = %v, want 130", position)
+	}
+	call("Seek", int64(-500e6))
+	if position, _, _ := player.snapshot(); position != 0 {
+		t.Fatalf("Seek -500s: position = %v, want 0", position)
+	}
+
+	metadata, _ := property("Metadata").(map[string]dbus.Variant)
+	trackID, _ := metadata["mpris:trackid"].Value().(dbus.ObjectPath)
+	if trackID != "/org/mpris/MediaPlayer2/octopus/episode/ep_1" {
+		t.Fatalf("track ID = %q", trackID)
+	}
+
+	// A position for a track that is no longer playing is ignored
+	call("SetPosition", dbus.ObjectPath("/org/mpris/MediaPlayer2/octopus/episode/old"), int64(600e6))
+	if _, _, seeks := player.snapshot(); seeks != 2 {
+		t.Fatalf("SetPosition with a stale track seeked, %d seeks", seeks)
+	}
+	call("SetPosition", trackID, int64(600e6))
+	if position, _, _ := player.snapshot(); position != 600 {
+		t.Fatalf("SetPosition: position = %v, want 600", position)
+	}
+
+	call("Next")
+	select {
+	case action := <-m.Actions():
+		if action != ActionNextEpisode {
+			t.Fatalf("Next queued %v", action)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next queued nothing")
+	}
+
+	// Closing gives up the name so widgets drop the player
+	m.Close()
+	var owned bool
+	if err := client.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, mprisName).Store(&owned); err != nil {
+		t.Fatal(err)
+	}
+	if owned {
+		t.Fatal("name still owned after Close")
+	}
+}
@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification is what a sink delivers to the user
+type Notification struct {
+	Kind    EventType `json:"kind"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Event   Event     `json:"event"`
+}
+
+// Notifier delivers notifications to one place, e.g. the desktop or a push service
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// NotificationSink is a notifier with the event types it wants, nil kinds means all of them
+type NotificationSink struct {
+	Name     string
+	Notifier Notifier
+	Kinds    map[EventType]bool
+}
+
+// ParseEventKinds reads a comma-separated event type list such as "show-finished,playback-error", "all" or ""
+func ParseEventKinds(list string) (map[EventType]bool, bool) {
+	kinds := make(map[EventType]bool)
+	for _, kind := range strings.Split(list, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "all" {
+			return nil, true
+		}
+		if kind != "" {
+			kinds[EventType(kind)] = true
+		}
+	}
+	return kinds, len(kinds) > 0
+}
+
+func (s NotificationSink) Wants(kind EventType) bool {
+	return s.Kinds == nil || s.Kinds[kind]
+}
+
+// Notifications turns events into notifications for every sink that wants them, sending in
+// the background so a slow push service can't hold up playback
+type Notifications struct {
+	Sinks   []NotificationSink
+	LogFile string
+	wg      sync.WaitGroup
+	jobs    chan func()
+}
+
+func NewNotifications(sinks []NotificationSink, logFile string) *Notifications {
+	n := &Notifications{Sinks: sinks, LogFile: logFile, jobs: make(chan func(), 32)}
+	go func() {
+		for job := range n.jobs {
+			job()
+			n.wg.Done()
+		}
+	}()
+	return n
+}
+
+// NotificationSinksFromConfig builds the configured sinks
+func NotificationSinksFromConfig(config *OctoConfig) []NotificationSink {
+	var sinks []NotificationSink
+	add := func(name string, enabled bool, notifier Notifier, events string) {
+		kinds, ok := ParseEventKinds(events)
+		if enabled && ok {
+			sinks = append(sinks, NotificationSink{Name: name, Notifier: notifier, Kinds: kinds})
+		}
+	}
+	add("desktop", true, DesktopNotifier{}, config.DesktopNotifyEvents)
+	add("webhook", config.WebhookURL != "", WebhookNotifier{URL: config.WebhookURL}, config.WebhookEvents)
+	add("ntfy", config.NtfyURL != "", NtfyNotifier{URL: config.NtfyURL, Token: config.NtfyToken}, config.NtfyEvents)
+	add("gotify", config.GotifyURL != "", GotifyNotifier{URL: config.GotifyURL, Token: config.GotifyToken}, config.GotifyEvents)
+	return sinks
+}
+
+// Wants reports whether any sink receives kind
+func (n *Notifications) Wants(kind EventType) bool {
+	for _, sink := range n.Sinks {
+		if sink.Wants(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle is subscribed to events
+func (n *Notifications) Handle(event Event) {
+	notification, ok := eventNotification(event)
+	if !ok {
+		return
+	}
+	for _, sink := range n.Sinks {
+		if !sink.Wants(event.Type) {
+			continue
+		}
+		sink := sink
+		n.wg.Add(1)
+		select {
+		case n.jobs <- func() {
+			if err := sink.Notifier.Notify(notification); err != nil {
+				Log(fmt.Sprintf("Error sending %s notification: %v", sink.Name, err), n.LogFile)
+			}
+		}:
+		default:
+			n.wg.Done()
+			Log(fmt.Sprintf("Dropped %s notification, too many pending", sink.Name), n.LogFile)
+		}
+	}
+}
+
+// Wait lets pending notifications go out before octopus exits
+func (n *Notifications) Wait() {
+	n.wg.Wait()
+}
+
+func eventNotification(event Event) (Notification, bool) {
+	notification := Notification{Kind: event.Type, Title: "Octopus", Event: event}
+	switch event.Type {
+	case EventSessionStart:
+		notification.Message = "Started watching " + event.ShowName
+	case EventEpisodeStart:
+		notification.Message = "Now playing " + event.Episode
+	case EventEpisodeCompleted:
+		notification.Message = "Watched " + event.Episode
+	case EventShowFinished:
+		notification.Message = "Finished " + event.ShowName
+	case EventPlaybackError:
+		notification.Title = "Octopus playback error"
+		notification.Message = event.Error
+	case EventMessage, EventNewEpisode:
+		notification.Message = event.Message
+	default:
+		return notification, false
+	}
+	return notification, notification.Message != ""
+}
+
+var notifyClient = http.Client{Timeout: 10 * time.Second}
+
+func postNotification(req *http.Request) error {
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DesktopNotifier shows notifications on the desktop, a new one of the same kind replaces the last
+type DesktopNotifier struct{}
+
+func (DesktopNotifier) Notify(notification Notification) error {
+	desktop, err := Desktop()
+	if err != nil {
+		return err
+	}
+	return desktop.Notify(string(notification.Kind), notification.Title, notification.Message)
+}
+
+// WebhookNotifier POSTs the notification as JSON
+type WebhookNotifier struct {
+	URL string
+}
+
+func (w WebhookNotifier) Notify(notification Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postNotification(req)
+}
+
+// NtfyNotifier publishes to an ntfy topic URL such as https://ntfy.sh/my-topic
+type NtfyNotifier struct {
+	URL   string
+	Token string
+}
+
+func (n NtfyNotifier) Notify(notification Notification) error {
+	req, err := http.NewRequest(http.MethodPost, n.URL, strings.NewReader(notification.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", notification.Title)
+	req.Header.Set("Tags", string(notification.Kind))
+	if notification.Kind == EventPlaybackError {
+		req.Header.Set("Priority", "high")
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return postNotification(req)
+}
+
+// GotifyNotifier sends to a Gotify server with an application token
+type GotifyNotifier struct {
+	URL   string
+	Token string
+}
+
+func (g GotifyNotifier) Notify(notification Notification) error {
+	priority := 5
+	if notification.Kind == EventPlaybackError {
+		priority = 8
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"title":    notification.Title,
+		"message":  notification.Message,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(g.URL, "/")+"/message", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.Token)
+	return postNotification(req)
+}
+
+// CheckNewEpisodes compares the episode count of every show in the database with the count
+// seen last time and emits a new-episode event for shows that grew. Counts are kept in countsFile.
+func CheckNewEpisodes(databaseFile string, countsFile string) error {
+	counts := make(map[string]int)
+	if data, err := os.ReadFile(countsFile); err == nil {
+		json.Unmarshal(data, &counts)
+	}
+
+	for _, show := range LocalGetAllShows(databaseFile) {
+		details, err := GetShow(show.ID)
+		if err != nil {
+			continue
+		}
+		count := len(details.EpisodesList)
+		previous, known := counts[show.ID]
+		counts[show.ID] = count
+		if !known || count <= previous {
+			continue
+		}
+
+		event := NewEvent(EventNewEpisode, details, show, 0)
+		if count-previous == 1 {
+			event.Message = "New episode of " + details.Name
+		} else {
+			event.Message = fmt.Sprintf("%d new episodes of %s", count-previous, details.Name)
+		}
+		Emit(event)
+	}
+
+	data, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(countsFile, data, 0644)
+}
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseEventKinds(t *testing.T) {
+	tests := []struct {
+		list  string
+		kinds map[EventType]bool
+		ok    bool
+	}{
+		{"", map[EventType]bool{}, false},
+		{" , ", map[EventType]bool{}, false},
+		{"all", nil, true},
+		{"show-finished, all", nil, true},
+		{"show-finished", map[EventType]bool{EventShowFinished: true}, true},
+		{" show-finished ,playback-error,", map[EventType]bool{EventShowFinished: true, EventPlaybackError: true}, true},
+	}
+	for _, tt := range tests {
+		kinds, ok := ParseEventKinds(tt.list)
+		if !reflect.DeepEqual(kinds, tt.kinds) || ok != tt.ok {
+			t.Errorf("ParseEventKinds(%q) = %v, %v, want %v, %v", tt.list, kinds, ok, tt.kinds, tt.ok)
+		}
+	}
+
+	sink := NotificationSink{Kinds: map[EventType]bool{EventShowFinished: true}}
+	if !sink.Wants(EventShowFinished) || sink.Wants(EventEpisodeStart) {
+		t.Error("sink with kinds wants the wrong events")
+	}
+	if !(NotificationSink{}).Wants(EventEpisodeStart) {
+		t.Error("sink for all kinds doesn't want episode-start")
+	}
+}
+
+// recordedRequest is what a stand-in push service received
+type recordedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+func newPushServer(t *testing.T, status int) (*httptest.Server, <-chan recordedRequest) {
+	t.Helper()
+	requests := make(chan recordedRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- recordedRequest{r.Method, r.URL.Path, r.Header, string(body)}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, requests := newPushServer(t, http.StatusNoContent)
+	notification := Notification{Kind: EventShowFinished, Title: "Octopus", Message: "Finished Show", Event: Event{Type: EventShowFinished, ShowID: "show"}}
+	if err := (WebhookNotifier{URL: server.URL + "/hook"}).Notify(notification); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if req.method != http.MethodPost || req.path != "/hook" || req.header.Get("Content-Type") != "application/json" {
+		t.Errorf("request = %s %s %s", req.method, req.path, req.header.Get("Content-Type"))
+	}
+	var got Notification
+	if err := json.Unmarshal([]byte(req.body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, notification) {
+		t.Errorf("body = %+v, want %+v", got, notification)
+	}
+}
+
+func TestNtfyNotifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     EventType
+		token    string
+		priority string
+		auth     string
+	}{
+		{"public topic", EventShowFinished, "", "", ""},
+		{"protected topic", EventNewEpisode, "tk_secret", "", "Bearer tk_secret"},
+		{"error is urgent", EventPlaybackError, "", "high", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newPushServer(t, http.StatusOK)
+			notification := Notification{Kind: tt.kind, Title: "Octopus", Message: "Something happened"}
+			if err := (NtfyNotifier{URL: server.URL + "/my-topic", Token: tt.token}).Notify(notification); err != nil {
+				t.Fatal(err)
+			}
+
+			req := <-requests
+			if req.method != http.MethodPost || req.path != "/my-topic" || req.body != "Something happened" {
+				t.Errorf("request = %s %s %q", req.method, req.path, req.body)
+			}
+			if req.header.Get("Title") != "Octopus" || req.header.Get("Tags") != string(tt.kind) {
+				t.Errorf("Title = %q, Tags = %q", req.header.Get("Title"), req.header.Get("Tags"))
+			}
+			if got := req.header.Get("Priority"); got != tt.priority {
+				t.Errorf("Priority = %q, want %q", got, tt.priority)
+			}
+			if got := req.header.Get("Authorization"); got != tt.auth {
+				t.Errorf("Authorization = %q, want %q", got, tt.auth)
+			}
+		})
+	}
+}
+
+func TestGotifyNotifier(t *testing.T) {
+	tests := []struct {
+		kind     EventType
+		priority int
+	}{
+		{EventNewEpisode, 5},
+		{EventPlaybackError, 8},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			server, requests := newPushServer(t, http.StatusOK)
+			notification := Notification{Kind: tt.kind, Title: "Octopus", Message: "Something happened"}
+			if err := (GotifyNotifier{URL: server.URL + "/", Token: "app-token"}).Notify(notification); err != nil {
+				t.Fatal(err)
+			}
+
+			req := <-requests
+			if req.method != http.MethodPost || req.path != "/message" {
+				t.Errorf("request = %s %s", req.method, req.path)
+			}
+			if req.header.Get("X-Gotify-Key") != "app-token" || req.header.Get("Content-Type") != "application/json" {
+				t.Errorf("X-Gotify-Key = %q, Content-Type = %q", req.header.Get("X-Gotify-Key"), req.header.Get("Content-Type"))
+			}
+			var body struct {
+				Title    string `json:"title"`
+				Message  string `json:"message"`
+				Priority int    `json:"priority"`
+			}
+			if err := json.Unmarshal([]byte(req.body), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Title != "Octopus" || body.Message != "Something happened" || body.Priority != tt.priority {
+				t.Errorf("body = %+v, want priority %d", body, tt.priority)
+			}
+		})
+	}
+}
+
+func TestNotifierErrorStatus(t *testing.T) {
+	server, _ := newPushServer(t, http.StatusUnauthorized)
+	err := (NtfyNotifier{URL: server.URL + "/my-topic"}).Notify(Notification{Message: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Notify error = %v, want the 401 status", err)
+	}
+}
+
+// vadapavStub lists shows with a given number of episodes in one season
+type vadapavStub struct {
+	mu       sync.Mutex
+	episodes map[string]int
+}
+
+func (v *vadapavStub) set(showID string, episodes int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.episodes[showID] = episodes
+}
+
+func (v *vadapavStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	id := strings.TrimPrefix(r.URL.Path, "/api/d/")
+	type file struct {
+		Dir  bool   `json:"dir"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	var name string
+	var files []file
+	if showID, ok := strings.CutSuffix(id, "-s1"); ok {
+		for i := 1; i <= v.episodes[showID]; i++ {
+			files = append(files, file{ID: fmt.Sprintf("%s-e%d", showID, i), Name: fmt.Sprintf("Show.S01E%02d.mkv", i)})
+		}
+	} else if _, ok := v.episodes[id]; ok {
+		name = "Show " + id
+		files = []file{{Dir: true, ID: id + "-s1", Name: "Season 1"}}
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"id": id, "name": name, "files": files}})
+}
+
+func TestCheckNewEpisodes(t *testing.T) {
+	stub := &vadapavStub{episodes: map[string]int{"a": 3, "b": 5, "c": 2}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	defer func(api string) { vadapavAPI = api }(vadapavAPI)
+	vadapavAPI = server.URL + "/api/d/"
+
+	dir := t.TempDir()
+	databaseFile := filepath.Join(dir, "shows.db")
+	countsFile := filepath.Join(dir, "episode_counts.json")
+	t.Cleanup(func() { closeDatabase(t, databaseFile) })
+	for _, id := range []string{"a", "b", "c", "gone"} {
+		if err := LocalUpdateShow(databaseFile, TVShow{ID: id, EpisodeID: id + "-e1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var messages []string
+	Subscribe(func(event Event) {
+		if event.Type == EventNewEpisode {
+			mu.Lock()
+			messages = append(messages, event.ShowID+": "+event.Message)
+			mu.Unlock()
+		}
+	})
+	check := func() []string {
+		t.Helper()
+		if err := CheckNewEpisodes(databaseFile, countsFile); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got := messages
+		messages = nil
+		return got
+	}
+
+	// The first run only notes the counts
+	if got := check(); len(got) != 0 {
+		t.Errorf("first run announced %v", got)
+	}
+	var counts map[string]int
+	data, err := os.ReadFile(countsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"a": 3, "b": 5, "c": 2}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+
+	stub.set("a", 4)
+	stub.set("b", 7)
+	stub.set("c", 1)
+	want := []string{"a: New episode of Show a", "b: 2 new episodes of Show b"}
+	if got := check(); !reflect.DeepEqual(got, want) {
+		t.Errorf("announced %v, want %v", got, want)
+	}
+	if got := check(); len(got) != 0 {
+		t.Errorf("unchanged shows announced %v", got)
+	}
+
+	// A show that can't be fetched keeps its count for next time
+	stub.mu.Lock()
+	delete(stub.episodes, "a")
+	stub.mu.Unlock()
+	check()
+	stub.set("a", 5)
+	if got := check(); !reflect.DeepEqual(got, []string{"a: New episode of Show a"}) {
+		t.Errorf("announced %v after a failed fetch, want the one new episode", got)
+	}
+}
@@ -0,0 +1,437 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Seconds a participant may drift from the host before being seeked back in sync
+	partyMaxDrift = 2.0
+	// Seconds a position may jump before it counts as a seek
+	partySeekThreshold = 2.0
+)
+
+// PartyState is the playback state shared between watch party participants
+type PartyState struct {
+	ShowID    string  `json:"show_id"`
+	EpisodeID string  `json:"episode_id"`
+	Position  float64 `json:"position"`
+	Paused    bool    `json:"paused"`
+	Speed     float64 `json:"speed"`
+}
+
+// PartyMessage is sent as one JSON line: "sync" is the host's periodic state, "change" a participant's
+// action. Participants measure the round trip to the host with a "ping" the host answers with a "pong".
+type PartyMessage struct {
+	Kind  string     `json:"kind"`
+	State PartyState `json:"state"`
+	// Unix milliseconds on the sender's clock when the message was sent. Clocks differ between
+	// machines, so it is only ever compared with times from the same clock.
+	SentAt int64 `json:"sent_at"`
+	// On syncs, SentAt of the last change the host applied, so a participant can tell whether
+	// the sync already includes its own change. On pongs, SentAt of the ping answered.
+	Applied int64 `json:"applied,omitempty"`
+	// When the message arrived, on the receiver's clock
+	receivedAt time.Time
+}
+
+// Party is a watch party connection, either the host with its participants or a participant with its host
+type Party struct {
+	IsHost   bool
+	incoming chan PartyMessage
+	listener net.Listener
+	mu       sync.Mutex
+	peers    map[net.Conn]bool
+	// Last round trip to the host measured by a ping, participants only
+	rtt time.Duration
+	// Clock for tests
+	now func() time.Time
+}
+
+func newParty(isHost bool) *Party {
+	return &Party{
+		IsHost:   isHost,
+		incoming: make(chan PartyMessage, 64),
+		peers:    make(map[net.Conn]bool),
+	}
+}
+
+// HostParty listens for participants on addr, e.g. ":7777"
+func HostParty(addr string) (*Party, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to host party: %w", err)
+	}
+
+	party := newParty(true)
+	party.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			party.addPeer(conn)
+		}
+	}()
+	return party, nil
+}
+
+// JoinParty connects to a party host at addr, e.g. "192.168.1.10:7777"
+func JoinParty(addr string) (*Party, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join party: %w", err)
+	}
+
+	party := newParty(false)
+	party.addPeer(conn)
+	return party, nil
+}
+
+func (p *Party) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+func (p *Party) addPeer(conn net.Conn) {
+	p.mu.Lock()
+	p.peers[conn] = true
+	p.mu.Unlock()
+	go p.read(conn)
+}
+
+func (p *Party) read(conn net.Conn) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.peers, conn)
+		p.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var msg PartyMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		msg.receivedAt = p.clock()
+		switch {
+		case p.IsHost && msg.Kind == "ping":
+			p.reply(conn, PartyMessage{Kind: "pong", Applied: msg.SentAt})
+			continue
+		case !p.IsHost && msg.Kind == "pong":
+			p.mu.Lock()
+			p.rtt = msg.receivedAt.Sub(time.UnixMilli(msg.Applied))
+			p.mu.Unlock()
+			continue
+		}
+		// The host passes changes on to everyone else
+		if p.IsHost && msg.Kind == "change" {
+			p.send(msg, conn)
+		}
+		select {
+		case p.incoming <- msg:
+		default:
+			// Playback loop is behind, newer state will follow
+		}
+	}
+}
+
+// Send delivers a message to the host, or as the host to every participant
+func (p *Party) Send(msg PartyMessage) {
+	p.send(msg, nil)
+}
+
+func (p *Party) send(msg PartyMessage, except net.Conn) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for conn := range p.peers {
+		if conn == except {
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(data); err != nil {
+			conn.Close()
+		}
+	}
+}
+
+// reply sends a message to one peer only
+func (p *Party) reply(conn net.Conn, msg PartyMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(data); err != nil {
+		conn.Close()
+	}
+}
+
+// Ping asks the host for a pong to measure the round trip, see RTT
+func (p *Party) Ping() {
+	p.Send(PartyMessage{Kind: "ping", SentAt: p.clock().UnixMilli()})
+}
+
+// RTT returns the last measured round trip to the host, 0 before the first pong
+func (p *Party) RTT() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rtt
+}
+
+// Incoming returns messages received from the party
+func (p *Party) Incoming() <-chan PartyMessage {
+	return p.incoming
+}
+
+// WaitForState waits for the first message that names a show, used by participants to know what to play
+func (p *Party) WaitForState(timeout time.Duration) (PartyState, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-p.incoming:
+			if msg.State.ShowID != "" && msg.State.EpisodeID != "" {
+				return msg.State, nil
+			}
+		case <-deadline:
+			return PartyState{}, fmt.Errorf("no playback state received from the party host")
+		}
+	}
+}
+
+func (p *Party) Close() {
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for conn := range p.peers {
+		conn.Close()
+	}
+}
+
+const (
+	// How long a participant ignores host syncs that don't include its own change yet
+	partyChangeGrace = 5 * time.Second
+	// Most a sync's position is moved on for the time it spent in transit
+	partyMaxTransit = 5 * time.Second
+	// How often participants measure the round trip to the host
+	partyPingInterval = 10 * time.Second
+)
+
+// PartySync mirrors a player with the rest of the party, one call per playback loop tick
+type PartySync struct {
+	Party          *Party
+	last           PartyState
+	lastAt         time.Time
+	pendingEpisode string
+	// SentAt of our last change, and for the host the last change it applied
+	changedAt int64
+	applied   int64
+	pingedAt  time.Time
+}
+
+func (s *PartySync) clock() time.Time {
+	return s.Party.clock()
+}
+
+// Tick shares local changes, then applies what the party sent since the last call. It returns an
+// episode ID when the party moved to another episode and the playback loop should switch to it.
+func (s *PartySync) Tick(player MediaPlayer, showID string, episodeID string) string {
+	current, err := readPartyState(player, showID, episodeID)
+	if err != nil {
+		return ""
+	}
+
+	if !s.Party.IsHost && s.clock().Sub(s.pingedAt) >= partyPingInterval {
+		s.Party.Ping()
+		s.pingedAt = s.clock()
+	}
+
+	// Wait for our own switch to catch up before comparing states again
+	if s.pendingEpisode != "" {
+		if episodeID != s.pendingEpisode {
+			return ""
+		}
+		s.pendingEpisode = ""
+		s.remember(current)
+	}
+
+	// Our own pause, seek, speed or episode change goes out before anything queued from the party
+	// can overwrite it
+	localChange := s.changed(current)
+	if localChange {
+		s.changedAt = s.clock().UnixMilli()
+		if s.Party.IsHost {
+			s.applied = s.changedAt
+		}
+		s.Party.Send(PartyMessage{Kind: "change", State: current, SentAt: s.changedAt})
+		s.remember(current)
+	}
+
+	// Changes apply in order, of the host's syncs only the newest matters
+	var sync *PartyMessage
+	for drained := false; !drained; {
+		select {
+		case msg := <-s.Party.Incoming():
+			if msg.State.ShowID != showID {
+				continue
+			}
+			if msg.Kind == "sync" {
+				if !s.stale(msg) {
+					sync = &msg
+				}
+				continue
+			}
+			sync = nil
+			if s.Party.IsHost {
+				s.applied = msg.SentAt
+			}
+			if msg.State.EpisodeID != episodeID {
+				s.pendingEpisode = msg.State.EpisodeID
+				return msg.State.EpisodeID
+			}
+			current = s.apply(player, current, msg)
+		default:
+			drained = true
+		}
+	}
+	if sync != nil {
+		if sync.State.EpisodeID != episodeID {
+			s.pendingEpisode = sync.State.EpisodeID
+			return sync.State.EpisodeID
+		}
+		current = s.apply(player, current, *sync)
+	}
+
+	if s.Party.IsHost && !localChange {
+		s.Party.Send(PartyMessage{Kind: "sync", State: current, SentAt: s.clock().UnixMilli(), Applied: s.applied})
+	}
+	s.remember(current)
+	return ""
+}
+
+// stale reports whether a host sync was sent before the host saw our latest change. Applied is
+// only checked for our own SentAt, other participants' times come from other clocks.
+func (s *PartySync) stale(msg PartyMessage) bool {
+	if s.changedAt == 0 || msg.Applied == s.changedAt {
+		return false
+	}
+	return s.clock().Sub(time.UnixMilli(s.changedAt)) < partyChangeGrace
+}
+
+func (s *PartySync) apply(player MediaPlayer, current PartyState, msg PartyMessage) PartyState {
+	target := msg.State
+	if target.Paused != current.Paused {
+		player.SetPaused(target.Paused)
+	}
+	if target.Speed > 0 && math.Abs(target.Speed-current.Speed) > 0.01 {
+		player.SetSpeed(target.Speed)
+	}
+
+	// Playback went on while the host's state was on its way and waiting for this tick. The host's
+	// clock can't be compared with ours, so the way here is taken as half the measured round trip.
+	if msg.Kind == "sync" && !target.Paused {
+		transit := s.Party.RTT() / 2
+		if !msg.receivedAt.IsZero() {
+			transit += s.clock().Sub(msg.receivedAt)
+		}
+		if transit > partyMaxTransit {
+			transit = partyMaxTransit
+		}
+		if transit > 0 {
+			speed := target.Speed
+			if speed <= 0 {
+				speed = 1
+			}
+			target.Position += transit.Seconds() * speed
+		}
+	}
+
+	// Follow seeks right away, and correct drift from the host's periodic state
+	limit := partySeekThreshold
+	if msg.Kind == "sync" {
+		limit = partyMaxDrift
+	}
+	if math.Abs(target.Position-current.Position) > limit {
+		player.Seek(int(target.Position + 0.5))
+		current.Position = target.Position
+	}
+
+	current.Paused = target.Paused
+	if target.Speed > 0 {
+		current.Speed = target.Speed
+	}
+	s.remember(current)
+	return current
+}
+
+// changed reports whether the viewer paused, seeked, changed speed or episode since the last tick
+func (s *PartySync) changed(current PartyState) bool {
+	if s.lastAt.IsZero() {
+		return false
+	}
+	if current.EpisodeID != s.last.EpisodeID || current.Paused != s.last.Paused {
+		return true
+	}
+	if current.Speed > 0 && s.last.Speed > 0 && math.Abs(current.Speed-s.last.Speed) > 0.01 {
+		return true
+	}
+
+	expected := s.last.Position
+	if !s.last.Paused {
+		speed := s.last.Speed
+		if speed <= 0 {
+			speed = 1
+		}
+		expected += s.clock().Sub(s.lastAt).Seconds() * speed
+	}
+	return math.Abs(current.Position-expected) > partySeekThreshold
+}
+
+func (s *PartySync) remember(state PartyState) {
+	s.last = state
+	s.lastAt = s.clock()
+}
+
+func readPartyState(player MediaPlayer, showID string, episodeID string) (PartyState, error) {
+	position, _, err := player.Position()
+	if err != nil {
+		return PartyState{}, err
+	}
+	paused, err := player.Paused()
+	if err != nil {
+		return PartyState{}, err
+	}
+	speed, err := player.Speed()
+	if err != nil {
+		return PartyState{}, err
+	}
+	return PartyState{
+		ShowID:    showID,
+		EpisodeID: episodeID,
+		Position:  position,
+		Paused:    paused,
+		Speed:     speed,
+	}, nil
+}
@@ -0,0 +1,371 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePlayer is a MediaPlayer whose state tests set directly. Tests driving it from another
+// goroutine, like D-Bus handlers, read it back with snapshot.
+type fakePlayer struct {
+	mu       sync.Mutex
+	position float64
+	paused   bool
+	speed    float64
+	seeks    []int
+}
+
+func (p *fakePlayer) Entry() (int, error)                  { return 0, nil }
+func (p *fakePlayer) Duration() (float64, error)           { return 1400, nil }
+func (p *fakePlayer) ShowText(string, time.Duration) error { return nil }
+func (p *fakePlayer) Queue(string) error                   { return nil }
+func (p *fakePlayer) Next() error                          { return nil }
+func (p *fakePlayer) Quit() error                          { return nil }
+
+func (p *fakePlayer) Position() (float64, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position, true, nil
+}
+
+func (p *fakePlayer) Paused() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused, nil
+}
+
+func (p *fakePlayer) SetPaused(paused bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = paused
+	return nil
+}
+
+func (p *fakePlayer) Speed() (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speed, nil
+}
+
+func (p *fakePlayer) SetSpeed(speed float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speed = speed
+	return nil
+}
+
+func (p *fakePlayer) Seek(seconds int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seeks = append(p.seeks, seconds)
+	p.position = float64(seconds)
+	return nil
+}
+
+func (p *fakePlayer) snapshot() (position float64, paused bool, seeks int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position, p.paused, len(p.seeks)
+}
+
+// testClock is a settable clock for PartySync
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newTestSync returns a sync for a party with one peer, messages sent to it are read from the returned channel
+func newTestSync(t *testing.T, isHost bool, clock *testClock) (*PartySync, <-chan PartyMessage) {
+	t.Helper()
+	local, remote := net.Pipe()
+	t.Cleanup(func() { local.Close(); remote.Close() })
+
+	party := newParty(isHost)
+	party.now = clock.now
+	party.mu.Lock()
+	party.peers[local] = true
+	party.mu.Unlock()
+
+	sent := make(chan PartyMessage, 16)
+	go func() {
+		scanner := bufio.NewScanner(remote)
+		for scanner.Scan() {
+			var msg PartyMessage
+			// Round trip pings are covered by TestPartyPing
+			if json.Unmarshal(scanner.Bytes(), &msg) == nil && msg.Kind != "ping" {
+				sent <- msg
+			}
+		}
+	}()
+	return &PartySync{Party: party}, sent
+}
+
+func receive(t *testing.T, sent <-chan PartyMessage) PartyMessage {
+	t.Helper()
+	select {
+	case msg := <-sent:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message sent")
+		return PartyMessage{}
+	}
+}
+
+func TestPartySyncApply(t *testing.T) {
+	clock := &testClock{t: time.Unix(1000, 0)}
+	state := PartyState{ShowID: "show", EpisodeID: "ep1", Position: 100, Speed: 1}
+	// arrived builds a message that reached us ago before the tick
+	arrived := func(msg PartyMessage, ago time.Duration) PartyMessage {
+		msg.receivedAt = clock.t.Add(-ago)
+		return msg
+	}
+
+	tests := []struct {
+		name     string
+		msg      PartyMessage
+		rtt      time.Duration
+		wantSeek bool
+		wantPos  float64
+		paused   bool
+		speed    float64
+	}{
+		{"in sync", PartyMessage{Kind: "sync", State: PartyState{Position: 101, Speed: 1}}, 0, false, 100, false, 1},
+		{"drifted", PartyMessage{Kind: "sync", State: PartyState{Position: 110, Speed: 1}}, 0, true, 110, false, 1},
+		{"pause", PartyMessage{Kind: "change", State: PartyState{Position: 100, Paused: true, Speed: 1}}, 0, false, 100, true, 1},
+		{"speed", PartyMessage{Kind: "change", State: PartyState{Position: 100, Speed: 1.5}}, 0, false, 100, false, 1.5},
+		{"transit", arrived(PartyMessage{Kind: "sync", State: PartyState{Position: 100, Speed: 2}}, 1900*time.Millisecond), 200 * time.Millisecond, true, 104, false, 2},
+		{"transit capped", arrived(PartyMessage{Kind: "sync", State: PartyState{Position: 100, Speed: 1}}, time.Minute), 0, true, 105, false, 1},
+		{"paused ignores transit", arrived(PartyMessage{Kind: "sync", State: PartyState{Position: 100, Paused: true, Speed: 1}}, 3*time.Second), 0, false, 100, true, 1},
+		{"changes ignore transit", arrived(PartyMessage{Kind: "change", State: PartyState{Position: 100, Speed: 1}}, 3*time.Second), time.Second, false, 100, false, 1},
+		// The sender's clock never counts, however far it is off from ours
+		{"sender clock ahead", arrived(PartyMessage{Kind: "sync", State: PartyState{Position: 100, Speed: 1}, SentAt: clock.t.Add(time.Minute).UnixMilli()}, 0), 20 * time.Millisecond, false, 100, false, 1},
+		{"sender clock behind", arrived(PartyMessage{Kind: "sync", State: PartyState{Position: 100, Speed: 1}, SentAt: clock.t.Add(-time.Minute).UnixMilli()}, 0), 20 * time.Millisecond, false, 100, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			player := &fakePlayer{position: state.Position, speed: state.Speed}
+			party := newParty(false)
+			party.now = clock.now
+			party.rtt = tt.rtt
+			s := &PartySync{Party: party}
+			got := s.apply(player, state, tt.msg)
+			if (len(player.seeks) > 0) != tt.wantSeek {
+				t.Errorf("seeks = %v, want seek %v", player.seeks, tt.wantSeek)
+			}
+			if got.Position != tt.wantPos || player.position != tt.wantPos {
+				t.Errorf("position = %v (player %v), want %v", got.Position, player.position, tt.wantPos)
+			}
+			if got.Paused != tt.paused || player.paused != tt.paused {
+				t.Errorf("paused = %v (player %v), want %v", got.Paused, player.paused, tt.paused)
+			}
+			if got.Speed != tt.speed || player.speed != tt.speed {
+				t.Errorf("speed = %v (player %v), want %v", got.Speed, player.speed, tt.speed)
+			}
+		})
+	}
+}
+
+// A participant whose clock runs ahead of the host's keeps playing without being seeked every sync
+func TestPartySyncTickSkewedClock(t *testing.T) {
+	hostClock := time.Unix(1000, 0)
+	clock := &testClock{t: hostClock.Add(30 * time.Second)}
+	s, _ := newTestSync(t, false, clock)
+	s.Party.rtt = 40 * time.Millisecond
+	player := &fakePlayer{position: 100, speed: 1}
+	s.Tick(player, "show", "ep1")
+
+	for i := 0; i < 5; i++ {
+		clock.advance(time.Second)
+		hostClock = hostClock.Add(time.Second)
+		player.position++
+		s.Party.incoming <- PartyMessage{Kind: "sync", State: PartyState{ShowID: "show", EpisodeID: "ep1", Position: player.position, Speed: 1}, SentAt: hostClock.UnixMilli(), receivedAt: clock.t}
+		s.Tick(player, "show", "ep1")
+	}
+	if len(player.seeks) != 0 {
+		t.Fatalf("seeks = %v, want none", player.seeks)
+	}
+}
+
+func TestPartySyncTickSendsLocalChangeFirst(t *testing.T) {
+	clock := &testClock{t: time.Unix(1000, 0)}
+	s, sent := newTestSync(t, false, clock)
+	player := &fakePlayer{position: 100, speed: 1}
+	s.Tick(player, "show", "ep1")
+
+	// The host's sync from before our pause is already queued when we pause
+	s.Party.incoming <- PartyMessage{Kind: "sync", State: PartyState{ShowID: "show", EpisodeID: "ep1", Position: 101, Speed: 1}, SentAt: clock.t.UnixMilli()}
+	clock.advance(time.Second)
+	player.position = 101
+	player.paused = true
+	s.Tick(player, "show", "ep1")
+
+	msg := receive(t, sent)
+	if msg.Kind != "change" || !msg.State.Paused {
+		t.Fatalf("sent %+v, want a paused change", msg)
+	}
+	if !player.paused {
+		t.Fatal("stale host sync undid the local pause")
+	}
+
+	// Once the host has applied the change, its syncs are followed again
+	clock.advance(time.Second)
+	s.Party.incoming <- PartyMessage{Kind: "sync", State: PartyState{ShowID: "show", EpisodeID: "ep1", Position: 101, Speed: 1}, SentAt: clock.t.UnixMilli(), Applied: msg.SentAt}
+	s.Tick(player, "show", "ep1")
+	if player.paused {
+		t.Fatal("sync that includes our change was ignored")
+	}
+}
+
+func TestPartySyncTickStaleSyncExpires(t *testing.T) {
+	clock := &testClock{t: time.Unix(1000, 0)}
+	s, sent := newTestSync(t, false, clock)
+	player := &fakePlayer{position: 100, speed: 1}
+	s.Tick(player, "show", "ep1")
+
+	player.paused = true
+	s.Tick(player, "show", "ep1")
+	receive(t, sent)
+
+	// The host never got our change, after the grace period its state wins
+	clock.advance(partyChangeGrace + time.Second)
+	s.Party.incoming <- PartyMessage{Kind: "sync", State: PartyState{ShowID: "show", EpisodeID: "ep1", Position: 100, Speed: 1}, SentAt: clock.t.UnixMilli()}
+	s.Tick(player, "show", "ep1")
+	if player.paused {
+		t.Fatal("host sync still ignored after the grace period")
+	}
+}
+
+func TestPartySyncTickAppliesNewestSync(t *testing.T) {
+	clock := &testClock{t: time.Unix(1000, 0)}
+	s, _ := newTestSync(t, false, clock)
+	player := &fakePlayer{position: 100, speed: 1}
+	s.Tick(player, "show", "ep1")
+
+	for _, position := range []float64{200, 300, 400} {
+		s.Party.incoming <- PartyMessage{Kind: "sync", State: PartyState{ShowID: "show", EpisodeID: "ep1", Position: position, Speed: 1}, SentAt: clock.t.UnixMilli()}
+	}
+	s.Tick(player, "show", "ep1")
+	if len(player.seeks) != 1 || player.seeks[0] != 400 {
+		t.Fatalf("seeks = %v, want only the newest sync [400]", player.seeks)
+	}
+}
+
+func TestPartySyncTickEpisodeChange(t *testing.T) {
+	clock := &testClock{t: time.Unix(1000, 0)}
+	s, _ := newTestSync(t, false, clock)
+	player := &fakePlayer{position: 100, speed: 1}
+	s.Tick(player, "show", "ep1")
+
+	s.Party.incoming <- PartyMessage{Kind: "change", State: PartyState{ShowID: "show", EpisodeID: "ep2", Speed: 1}, SentAt: clock.t.UnixMilli()}
+	if got := s.Tick(player, "show", "ep1"); got != "ep2" {
+		t.Fatalf("Tick = %q, want ep2", got)
+	}
+	// Still on the old episode until the loop has switched
+	if got := s.Tick(player, "show", "ep1"); got != "" {
+		t.Fatalf("Tick = %q while switching, want nothing", got)
+	}
+}
+
+func TestPartySyncTickHostSendsSync(t *testing.T) {
+	clock := &testClock{t: time.Unix(1000, 0)}
+	s, sent := newTestSync(t, true, clock)
+	player := &fakePlayer{position: 100, speed: 1}
+	s.Tick(player, "show", "ep1")
+	receive(t, sent)
+
+	// A participant's pause is applied and acknowledged in the next sync
+	change := PartyMessage{Kind: "change", State: PartyState{ShowID: "show", EpisodeID: "ep1", Position: 100, Paused: true, Speed: 1}, SentAt: 12345}
+	s.Party.incoming <- change
+	s.Tick(player, "show", "ep1")
+	if !player.paused {
+		t.Fatal("host did not apply the participant's pause")
+	}
+	msg := receive(t, sent)
+	if msg.Kind != "sync" || msg.Applied != change.SentAt || !msg.State.Paused {
+		t.Fatalf("sent %+v, want a paused sync acknowledging %d", msg, change.SentAt)
+	}
+}
+
+func TestPartyPing(t *testing.T) {
+	host, err := HostParty("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	conn, err := net.Dial("tcp", host.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The round trip only uses the participant's clock, the host just echoes the ping's SentAt
+	var calls atomic.Int64
+	guest := newParty(false)
+	guest.now = func() time.Time { return time.Unix(1000, 0).Add(time.Duration(calls.Add(1)-1) * 40 * time.Millisecond) }
+	guest.addPeer(conn)
+	defer guest.Close()
+
+	guest.Ping()
+	deadline := time.Now().Add(2 * time.Second)
+	for guest.RTT() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rtt := guest.RTT(); rtt != 40*time.Millisecond {
+		t.Fatalf("RTT = %v, want 40ms", rtt)
+	}
+	select {
+	case msg := <-host.Incoming():
+		t.Fatalf("ping reached the playback loop: %+v", msg)
+	case msg := <-guest.Incoming():
+		t.Fatalf("pong reached the playback loop: %+v", msg)
+	default:
+	}
+}
+
+func TestPartyHostAndJoin(t *testing.T) {
+	host, err := HostParty("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	guest, err := JoinParty(host.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer guest.Close()
+
+	guest.Send(PartyMessage{Kind: "change", State: PartyState{ShowID: "show", EpisodeID: "ep1", Paused: true}})
+	select {
+	case msg := <-host.Incoming():
+		if msg.Kind != "change" || !msg.State.Paused {
+			t.Fatalf("host received %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("host received nothing")
+	}
+
+	// The host waits for the guest to be registered before it can reach it
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		host.mu.Lock()
+		peers := len(host.peers)
+		host.mu.Unlock()
+		if peers > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	host.Send(PartyMessage{Kind: "sync", State: PartyState{ShowID: "show", EpisodeID: "ep2"}})
+	state, err := guest.WaitForState(2 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.EpisodeID != "ep2" {
+		t.Fatalf("guest got %+v", state)
+	}
+}
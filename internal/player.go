@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -8,18 +9,33 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
     // "github.com/Microsoft/go-winio"
 )
 
 
-func PlayWithMPV(url string) (string, error) {	
+// PlayWithMPV starts mpv on url, without a video window when audioOnly is set
+func PlayWithMPV(url string, audioOnly bool, args ...string) (string, error) {
 	// Create a unique socket path in /tmp
 	socketPath := filepath.Join(os.TempDir(), fmt.Sprintf("mpv-socket-octo-%d", time.Now().UnixNano()))
 
-	// Start mpv with IPC socket and fullscreen
-	cmd := exec.Command("mpv", "--fs", "--input-ipc-server="+socketPath, url)
+	mpvArgs := []string{"--input-ipc-server=" + socketPath}
+	if audioOnly {
+		mpvArgs = append(mpvArgs, "--no-video", "--force-window=no")
+	} else {
+		mpvArgs = append(mpvArgs, "--fs")
+	}
+	mpvArgs = append(mpvArgs, args...)
+
+	cmd := exec.Command("mpv", append(mpvArgs, url)...)
+	if audioOnly {
+		// Without a window mpv is controlled from the terminal
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("failed to start mpv: %w", err)
 	}
@@ -28,6 +44,104 @@ func PlayWithMPV(url string) (string, error) {
 }
 
 
+// PlayWithExternal runs a user command template such as "vlc {url}" and waits for it to exit
+func PlayWithExternal(commandTemplate string, url string) error {
+	args, err := externalCommandArgs(commandTemplate, url)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// externalCommandArgs splits the template into arguments and puts url in place of {url} in each,
+// or adds it as the last argument when the template has no {url}
+func externalCommandArgs(commandTemplate string, url string) ([]string, error) {
+	fields, err := SplitCommand(commandTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("external player command is empty")
+	}
+
+	args := make([]string, len(fields))
+	for i, field := range fields {
+		args[i] = strings.ReplaceAll(field, "{url}", url)
+	}
+	if !strings.Contains(commandTemplate, "{url}") {
+		args = append(args, url)
+	}
+	return args, nil
+}
+
+// SplitCommand splits a command line into arguments like a shell would, without running one.
+// Single quotes keep everything literally, double quotes keep spaces, and a backslash escapes
+// a following quote, space or backslash. Other backslashes are kept, so Windows paths work as is.
+func SplitCommand(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\' && i+1 < len(runes) && escapable(quote, runes[i+1]):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command %q", quote, command)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// escapable reports whether a backslash before next escapes it, inside double quotes only " and \ do
+func escapable(quote rune, next rune) bool {
+	if quote == '"' {
+		return next == '"' || next == '\\'
+	}
+	return strings.ContainsRune("\"'\\ \t", next)
+}
+
 func MPVSendCommand(ipcSocketPath string, command []interface{}) (interface{}, error) {
     var conn net.Conn
     var err error
@@ -56,23 +170,74 @@ func MPVSendCommand(ipcSocketPath string, command []interface{}) (interface{}, e
         return nil, err
     }
 
-    // Receive the response
-    buf := make([]byte, 4096)
-    n, err := conn.Read(buf)
-    if err != nil {
-        return nil, err
-    }
+    // Receive the response, skipping any events mpv broadcasts to every client
+    reader := bufio.NewReader(conn)
+    for {
+        line, err := reader.ReadBytes('\n')
+        if err != nil {
+            return nil, err
+        }
 
-    var response map[string]interface{}
-    if err := json.Unmarshal(buf[:n], &response); err != nil {
-        return nil, err
-    }
+        var response map[string]interface{}
+        if err := json.Unmarshal(line, &response); err != nil {
+            return nil, err
+        }
 
-    if data, exists := response["data"]; exists {
-        return data, nil
+        if _, isEvent := response["event"]; isEvent {
+            continue
+        }
+
+        if data, exists := response["data"]; exists {
+            return data, nil
+        }
+
+        return nil, nil
     }
+}
+
+// MPVEvent is an asynchronous message mpv pushes to IPC clients
+type MPVEvent struct {
+	Event  string      `json:"event"`
+	Name   string      `json:"name"`
+	Data   interface{} `json:"data"`
+	Args   []string    `json:"args"`
+	Reason string      `json:"reason"`
+}
+
+// MPVListenEvents keeps a connection to mpv open and streams its events until the player exits
+func MPVListenEvents(ipcSocketPath string) (<-chan MPVEvent, error) {
+	conn, err := net.Dial("unix", ipcSocketPath)
+	if err != nil {
+		return nil, err
+	}
 
-    return nil, nil
+	events := make(chan MPVEvent, 16)
+	go func() {
+		defer conn.Close()
+		defer close(events)
+
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var event MPVEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event.Event == "" {
+				continue
+			}
+			events <- event
+		}
+	}()
+
+	return events, nil
+}
+
+// MPVBindKey binds a key in the running mpv so that pressing it sends a script-message to octopus
+func MPVBindKey(ipcSocketPath string, key string, message ...string) error {
+	command := "script-message"
+	for _, arg := range message {
+		command += " " + arg
+	}
+	_, err := MPVSendCommand(ipcSocketPath, []interface{}{"keybind", key, command})
+	return err
 }
 
 func SeekMPV(ipcSocketPath string, time int) (interface{}, error) {
@@ -80,6 +245,30 @@ func SeekMPV(ipcSocketPath string, time int) (interface{}, error) {
     return MPVSendCommand(ipcSocketPath, command)
 }
 
+// MPVAppendToPlaylist queues a url after the current playlist entries
+func MPVAppendToPlaylist(ipcSocketPath string, url string) error {
+	_, err := MPVSendCommand(ipcSocketPath, []interface{}{"loadfile", url, "append"})
+	return err
+}
+
+// MPVClearPlaylist removes every playlist entry except the one currently playing
+func MPVClearPlaylist(ipcSocketPath string) error {
+	_, err := MPVSendCommand(ipcSocketPath, []interface{}{"playlist-clear"})
+	return err
+}
+
+// MPVPlaylistNext moves playback to the next playlist entry
+func MPVPlaylistNext(ipcSocketPath string) error {
+	_, err := MPVSendCommand(ipcSocketPath, []interface{}{"playlist-next", "force"})
+	return err
+}
+
+// MPVShowText displays text on mpv's on-screen display
+func MPVShowText(ipcSocketPath string, text string, duration time.Duration) error {
+	_, err := MPVSendCommand(ipcSocketPath, []interface{}{"show-text", text, duration.Milliseconds()})
+	return err
+}
+
 func GetMPVPausedStatus(ipcSocketPath string) (bool, error) {
     status, err := MPVSendCommand(ipcSocketPath, []interface{}{"get_property", "pause"})
     if err != nil || status == nil {
@@ -149,3 +338,32 @@ func PercentageWatched(playbackTime int, duration int) float64 {
     }
     return float64(0)
 }
+
+// ResumePosition rewinds a saved position a little, more the longer ago playback stopped
+func ResumePosition(position int, lastWatched int64, config *OctoConfig) int {
+	rewind := config.ResumeRewind
+	if config.ResumeRewindScale && lastWatched > 0 {
+		since := time.Since(time.Unix(lastWatched, 0))
+		switch {
+		case since > 7*24*time.Hour:
+			rewind *= 6
+		case since > 24*time.Hour:
+			rewind *= 3
+		case since > time.Hour:
+			rewind *= 2
+		}
+	}
+
+	if rewind >= position {
+		return 0
+	}
+	return position - rewind
+}
+
+// FormatTime renders seconds as mm:ss or h:mm:ss
+func FormatTime(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{"vlc {url}", []string{"vlc", "{url}"}, false},
+		{"  vlc   --fullscreen\t{url} ", []string{"vlc", "--fullscreen", "{url}"}, false},
+		{`"/Applications/My Player.app/player" {url}`, []string{"/Applications/My Player.app/player", "{url}"}, false},
+		{`player --title 'Now playing: "{url}"'`, []string{"player", "--title", `Now playing: "{url}"`}, false},
+		{`player --title "it's \"here\""`, []string{"player", "--title", `it's "here"`}, false},
+		{`My\ Player {url}`, []string{"My Player", "{url}"}, false},
+		{`C:\Program Files\VLC\vlc.exe`, []string{`C:\Program`, `Files\VLC\vlc.exe`}, false},
+		{`"C:\Program Files\VLC\vlc.exe" {url}`, []string{`C:\Program Files\VLC\vlc.exe`, "{url}"}, false},
+		{`'a\b'`, []string{`a\b`}, false},
+		{`player ""`, []string{"player", ""}, false},
+		{`kodi-send --action=PlayMedia({url})`, []string{"kodi-send", "--action=PlayMedia({url})"}, false},
+		{"", nil, false},
+		{`player "unterminated`, nil, true},
+		{`player 'unterminated`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := SplitCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitCommand(%q) error = %v", tt.command, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalCommandArgs(t *testing.T) {
+	url := "https://example.com/Show S01E01.mkv"
+	tests := []struct {
+		template string
+		want     []string
+		wantErr  bool
+	}{
+		{"vlc {url}", []string{"vlc", url}, false},
+		{"vlc", []string{"vlc", url}, false},
+		{`"My Player" --title "Watching" {url}`, []string{"My Player", "--title", "Watching", url}, false},
+		{"kodi-send --action=PlayMedia({url})", []string{"kodi-send", "--action=PlayMedia(" + url + ")"}, false},
+		{"   ", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := externalCommandArgs(tt.template, url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("externalCommandArgs(%q) error = %v", tt.template, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("externalCommandArgs(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumePosition(t *testing.T) {
+	ago := func(d time.Duration) int64 { return time.Now().Add(-d).Unix() }
+	scaled := OctoConfig{ResumeRewind: 10, ResumeRewindScale: true}
+	fixed := OctoConfig{ResumeRewind: 10}
+
+	tests := []struct {
+		name        string
+		position    int
+		lastWatched int64
+		config      OctoConfig
+		want        int
+	}{
+		{"just stopped", 600, ago(time.Minute), scaled, 590},
+		{"over an hour ago", 600, ago(2 * time.Hour), scaled, 580},
+		{"over a day ago", 600, ago(48 * time.Hour), scaled, 570},
+		{"over a week ago", 600, ago(8 * 24 * time.Hour), scaled, 540},
+		{"never saved", 600, 0, scaled, 590},
+		{"scaling off", 600, ago(8 * 24 * time.Hour), fixed, 590},
+		{"no rewind", 600, ago(8 * 24 * time.Hour), OctoConfig{ResumeRewindScale: true}, 600},
+		{"rewind past the start", 30, ago(8 * 24 * time.Hour), scaled, 0},
+		{"rewind to the start", 10, ago(time.Minute), fixed, 0},
+		{"from the start", 0, ago(time.Minute), fixed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResumePosition(tt.position, tt.lastWatched, &tt.config); got != tt.want {
+				t.Errorf("ResumePosition(%d) = %d, want %d", tt.position, got, tt.want)
+			}
+		})
+	}
+}
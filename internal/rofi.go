@@ -6,11 +6,16 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strings"
 )
 
 func RofiSelect(options map[string]string, addanimeopt bool) (SelectionOption, error) {
+	// Sort the options alphabetically
+	return RofiSelectOrdered(sortedOptions(options), addanimeopt)
+}
+
+// RofiSelectOrdered shows the options in rofi in the given order
+func RofiSelectOrdered(options []SelectionOption, addanimeopt bool) (SelectionOption, error) {
 	userCurdConfig := GetGlobalConfig()
 	if userCurdConfig.StoragePath == "" {
 		userCurdConfig.StoragePath = os.ExpandEnv("${HOME}/.local/share/octo")
@@ -18,13 +23,10 @@ func RofiSelect(options map[string]string, addanimeopt bool) (SelectionOption, e
 
 	// Create a slice to store the options in the order we want
 	var optionsList []string
-	for _, value := range options {
-		optionsList = append(optionsList, value)
+	for _, option := range options {
+		optionsList = append(optionsList, option.Label)
 	}
 	
-	// Sort the options alphabetically
-	sort.Strings(optionsList)
-	
 	// Add "Add new anime" and "Quit" options
 	if addanimeopt {
 		optionsList = append(optionsList, "Add new show", "Quit")
@@ -63,9 +65,9 @@ func RofiSelect(options map[string]string, addanimeopt bool) (SelectionOption, e
 	}
 	
 	// Find the key for the selected value
-	for key, value := range options {
-		if value == selected {
-			return SelectionOption{Label: value, Key: key}, nil
+	for _, option := range options {
+		if option.Label == selected {
+			return option, nil
 		}
 	}
 	
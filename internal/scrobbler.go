@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Scrobbler reports episode starts as "now watching" and completed episodes as watched.
+// Watched scrobbles that fail because the tracker can't be reached are kept in an offline
+// queue and sent with their original time at the start of a later session.
+type Scrobbler struct {
+	Tracker   *Tracker
+	QueueFile string
+	LogFile   string
+	mu        sync.Mutex
+	mappings  map[string]string
+	wg        sync.WaitGroup
+	// Requests run one at a time, in the order events happened
+	jobs chan func()
+}
+
+func NewScrobbler(tracker *Tracker, queueFile string, logFile string) *Scrobbler {
+	s := &Scrobbler{
+		Tracker:   tracker,
+		QueueFile: queueFile,
+		LogFile:   logFile,
+		mappings:  make(map[string]string),
+		jobs:      make(chan func(), 16),
+	}
+	go func() {
+		for job := range s.jobs {
+			job()
+			s.wg.Done()
+		}
+	}()
+	return s
+}
+
+// SetMapping tells the scrobbler which tracker show a show ID belongs to
+func (s *Scrobbler) SetMapping(showID string, trackerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mappings[showID] = trackerID
+}
+
+func (s *Scrobbler) trackerID(showID string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ParseTrackerID(s.mappings[showID])
+}
+
+// Handle queues the tracker requests for an event, without waiting for them
+func (s *Scrobbler) Handle(event Event) {
+	switch event.Type {
+	case EventSessionStart:
+		s.queue(func() {
+			if err := s.FlushQueue(); err != nil {
+				Log("Error sending queued scrobbles: "+err.Error(), s.LogFile)
+			}
+		})
+	case EventEpisodeStart, EventResumed:
+		s.scrobble("start", event)
+	case EventPaused:
+		s.scrobble("pause", event)
+	case EventEpisodeStopped:
+		// Stopped part-way, the tracker only counts it as watched from 80%
+		s.scrobble("stop", event)
+	case EventEpisodeCompleted:
+		trackerID, ok := s.trackerID(event.ShowID)
+		if !ok || event.Number == 0 {
+			return
+		}
+		s.queue(func() {
+			// Octopus already decided the episode counts as watched, which may be before the tracker's 80%
+			err := s.Tracker.Scrobble("stop", trackerID, event.Season, event.Number, 100)
+			if err == nil {
+				s.flushAfterScrobble()
+				return
+			}
+			Log("Error scrobbling watched episode: "+err.Error(), s.LogFile)
+
+			var trackerErr *TrackerError
+			if errors.As(err, &trackerErr) && !trackerErr.Retryable() {
+				return
+			}
+			item := ScrobbleItem{TrackerID: trackerID, Season: event.Season, Number: event.Number, WatchedAt: event.Time}
+			if err := s.enqueue(item); err != nil {
+				Log("Error saving scrobble for later: "+err.Error(), s.LogFile)
+			}
+		})
+	}
+}
+
+// scrobble reports the event's episode and progress, these aren't worth keeping for later
+func (s *Scrobbler) scrobble(action string, event Event) {
+	trackerID, ok := s.trackerID(event.ShowID)
+	if !ok || event.Number == 0 {
+		return
+	}
+	s.queue(func() {
+		err := s.Tracker.Scrobble(action, trackerID, event.Season, event.Number, PercentageWatched(event.Position, event.Duration))
+		if err != nil {
+			Log(fmt.Sprintf("Error scrobbling %s: %v", action, err), s.LogFile)
+			return
+		}
+		s.flushAfterScrobble()
+	})
+}
+
+// flushAfterScrobble sends the offline queue once the tracker is reachable again, instead of
+// waiting for the next session
+func (s *Scrobbler) flushAfterScrobble() {
+	if err := s.FlushQueue(); err != nil {
+		Log("Error sending queued scrobbles: "+err.Error(), s.LogFile)
+	}
+}
+
+func (s *Scrobbler) queue(job func()) {
+	s.wg.Add(1)
+	select {
+	case s.jobs <- job:
+	default:
+		// Too far behind, the tracker is probably unreachable
+		s.wg.Done()
+		Log("Dropped scrobble, too many pending requests", s.LogFile)
+	}
+}
+
+// Wait lets pending tracker requests finish before octopus exits
+func (s *Scrobbler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scrobbler) loadQueue() ([]ScrobbleItem, error) {
+	data, err := os.ReadFile(s.QueueFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []ScrobbleItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("error decoding scrobble queue: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Scrobbler) saveQueue(items []ScrobbleItem) error {
+	if len(items) == 0 {
+		err := os.Remove(s.QueueFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.QueueFile, data, 0644)
+}
+
+func (s *Scrobbler) enqueue(item ScrobbleItem) error {
+	// Other instances may be adding to or sending the queue
+	lock, err := LockFile(s.QueueFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	items, err := s.loadQueue()
+	if err != nil {
+		return err
+	}
+	return s.saveQueue(append(items, item))
+}
+
+// FlushQueue sends every queued scrobble, keeping them queued if the tracker is still unreachable
+func (s *Scrobbler) FlushQueue() error {
+	lock, err := LockFile(s.QueueFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	items, err := s.loadQueue()
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	if err := s.Tracker.AddToHistory(items); err != nil {
+		var trackerErr *TrackerError
+		if errors.As(err, &trackerErr) && !trackerErr.Retryable() {
+			// The tracker rejected them, retrying won't help
+			s.saveQueue(nil)
+		}
+		return err
+	}
+	Log(fmt.Sprintf("Sent %d queued scrobbles", len(items)), s.LogFile)
+	return s.saveQueue(nil)
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 	"github.com/charmbracelet/bubbletea"
@@ -15,7 +16,7 @@ type SelectionOption struct {
 
 // Model represents the application state for the selection prompt
 type Model struct {
-	options        map[string]string  // id -> name mapping
+	options        []SelectionOption  // in display order
 	filter         string
 	filteredKeys   []SelectionOption
 	selected       int
@@ -120,20 +121,12 @@ func (m Model) visibleItemsCount() int {
 func (m *Model) filterOptions() {
 	m.filteredKeys = []SelectionOption{}
 
-	for id, name := range m.options {
-		if strings.Contains(strings.ToLower(name), strings.ToLower(m.filter)) {
-			m.filteredKeys = append(m.filteredKeys, SelectionOption{
-				Label: name,
-				Key:   id,
-			})
+	for _, option := range m.options {
+		if strings.Contains(strings.ToLower(option.Label), strings.ToLower(m.filter)) {
+			m.filteredKeys = append(m.filteredKeys, option)
 		}
 	}
 
-	// Sort by label
-	sort.Slice(m.filteredKeys, func(i, j int) bool {
-		return m.filteredKeys[i].Label < m.filteredKeys[j].Label
-	})
-
 	// Add quit option at the end
 	m.filteredKeys = append(m.filteredKeys, SelectionOption{
 		Label: "Quit",
@@ -141,19 +134,45 @@ func (m *Model) filterOptions() {
 	})
 }
 
-// DynamicSelect shows a selection menu and returns the selected option
+// DynamicSelect shows a selection menu sorted by label and returns the selected option
 func DynamicSelect(options map[string]string) (SelectionOption, error) {
 	config := GetGlobalConfig()
 	if config != nil && config.RofiSelection {
 		return RofiSelect(options, false)
 	}
+	return OrderedSelect(sortedOptions(options))
+}
+
+// sortedOptions lists options by label
+func sortedOptions(options map[string]string) []SelectionOption {
+	list := make([]SelectionOption, 0, len(options))
+	for key, label := range options {
+		list = append(list, SelectionOption{Label: label, Key: key})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Label < list[j].Label
+	})
+	return list
+}
+
+// OrderedSelect shows a selection menu keeping the options in the given order, e.g. most recent first
+func OrderedSelect(options []SelectionOption) (SelectionOption, error) {
+	config := GetGlobalConfig()
+	if config != nil && config.RofiSelection {
+		return RofiSelectOrdered(options, false)
+	}
 	model := &Model{
 		options:      options,
 		filteredKeys: make([]SelectionOption, 0),
 	}
 
 	model.filterOptions()
-	p := tea.NewProgram(model)
+	var programOptions []tea.ProgramOption
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice == 0 {
+		// Stdout is piped (e.g. -print-url), draw the menu on stderr instead
+		programOptions = append(programOptions, tea.WithOutput(os.Stderr))
+	}
+	p := tea.NewProgram(model, programOptions...)
 
 	finalModel, err := p.Run()
 	if err != nil {
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SkipRange is a span of an episode in seconds that can be jumped over
+type SkipRange struct {
+	Start int
+	End   int
+}
+
+// SkipMarkers holds the intro and outro ranges recorded for a season
+type SkipMarkers struct {
+	Intro SkipRange
+	Outro SkipRange
+}
+
+// Chapter is a single entry of mpv's chapter-list property
+type Chapter struct {
+	Title string
+	Time  float64
+}
+
+var (
+	introChapterPattern = regexp.MustCompile(`(?i)\b(opening|intro|op)\b`)
+	outroChapterPattern = regexp.MustCompile(`(?i)\b(ending|outro|credits|ed)\b`)
+)
+
+func (r SkipRange) Valid() bool {
+	return r.End > r.Start
+}
+
+// Contains reports whether pos falls inside the range, ignoring the last second so a seek to End doesn't retrigger
+func (r SkipRange) Contains(pos int) bool {
+	return r.Valid() && pos >= r.Start && pos < r.End-1
+}
+
+// GetMPVChapters returns the chapters of the file currently loaded in mpv
+func GetMPVChapters(ipcSocketPath string) ([]Chapter, error) {
+	data, err := MPVSendCommand(ipcSocketPath, []interface{}{"get_property", "chapter-list"})
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	list, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected chapter-list format")
+	}
+
+	var chapters []Chapter
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		title, _ := entry["title"].(string)
+		time, _ := entry["time"].(float64)
+		chapters = append(chapters, Chapter{Title: title, Time: time})
+	}
+	return chapters, nil
+}
+
+// ChapterSkipMarkers derives intro and outro ranges from chapter titles like "Opening" or "Ending"
+func ChapterSkipMarkers(chapters []Chapter, duration int) SkipMarkers {
+	var markers SkipMarkers
+	for i, chapter := range chapters {
+		end := duration
+		if i+1 < len(chapters) {
+			end = int(chapters[i+1].Time)
+		}
+		r := SkipRange{Start: int(chapter.Time), End: end}
+
+		if !markers.Intro.Valid() && introChapterPattern.MatchString(chapter.Title) {
+			markers.Intro = r
+		} else if !markers.Outro.Valid() && outroChapterPattern.MatchString(chapter.Title) {
+			markers.Outro = r
+		}
+	}
+	return markers
+}
+
+// EpisodeSkipMarkers picks the ranges to use for an episode: chapters first, then the
+// markers recorded for its season, then the ones recorded for the whole show
+func EpisodeSkipMarkers(chapterMarkers SkipMarkers, recorded map[int]SkipMarkers, season int) SkipMarkers {
+	markers := chapterMarkers
+	for _, key := range []int{season, 0} {
+		if saved, ok := recorded[key]; ok {
+			if !markers.Intro.Valid() {
+				markers.Intro = saved.Intro
+			}
+			if !markers.Outro.Valid() {
+				markers.Outro = saved.Outro
+			}
+		}
+	}
+	return markers
+}
+
+// SkipRecorder pairs two keypresses into a skip range
+type SkipRecorder struct {
+	pending map[string]int
+}
+
+// Mark records pos for kind ("intro" or "outro"); the second call returns the finished range
+func (r *SkipRecorder) Mark(kind string, pos int) (SkipRange, bool) {
+	if r.pending == nil {
+		r.pending = make(map[string]int)
+	}
+
+	start, ok := r.pending[kind]
+	if !ok {
+		r.pending[kind] = pos
+		return SkipRange{}, false
+	}
+	delete(r.pending, kind)
+
+	if pos < start {
+		start, pos = pos, start
+	}
+	return SkipRange{Start: start, End: pos}, true
+}
+
+// SetSkipMarker stores a recorded range for the given season on the show
+func SetSkipMarker(show *TVShow, season int, kind string, r SkipRange) {
+	if show.SkipMarkers == nil {
+		show.SkipMarkers = make(map[int]SkipMarkers)
+	}
+	markers := show.SkipMarkers[season]
+	if kind == "outro" {
+		markers.Outro = r
+	} else {
+		markers.Intro = r
+	}
+	show.SkipMarkers[season] = markers
+}
+
+// EncodeSkipMarkers serializes markers as "season:introStart-introEnd/outroStart-outroEnd;..."
+func EncodeSkipMarkers(markers map[int]SkipMarkers) string {
+	seasons := make([]int, 0, len(markers))
+	for season := range markers {
+		seasons = append(seasons, season)
+	}
+	sort.Ints(seasons)
+
+	var parts []string
+	for _, season := range seasons {
+		m := markers[season]
+		parts = append(parts, fmt.Sprintf("%d:%s/%s", season, encodeSkipRange(m.Intro), encodeSkipRange(m.Outro)))
+	}
+	return strings.Join(parts, ";")
+}
+
+// DecodeSkipMarkers parses the format written by EncodeSkipMarkers, ignoring malformed entries
+func DecodeSkipMarkers(value string) map[int]SkipMarkers {
+	markers := make(map[int]SkipMarkers)
+	for _, part := range strings.Split(value, ";") {
+		seasonStr, ranges, found := strings.Cut(part, ":")
+		if !found {
+			continue
+		}
+		season, err := strconv.Atoi(seasonStr)
+		if err != nil {
+			continue
+		}
+		intro, outro, _ := strings.Cut(ranges, "/")
+		markers[season] = SkipMarkers{
+			Intro: decodeSkipRange(intro),
+			Outro: decodeSkipRange(outro),
+		}
+	}
+	return markers
+}
+
+func encodeSkipRange(r SkipRange) string {
+	if !r.Valid() {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+func decodeSkipRange(value string) SkipRange {
+	startStr, endStr, found := strings.Cut(value, "-")
+	if !found {
+		return SkipRange{}
+	}
+	start, err1 := strconv.Atoi(startStr)
+	end, err2 := strconv.Atoi(endStr)
+	if err1 != nil || err2 != nil {
+		return SkipRange{}
+	}
+	return SkipRange{Start: start, End: end}
+}
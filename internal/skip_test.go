@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeSkipMarkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers map[int]SkipMarkers
+		want    string
+	}{
+		{"empty", nil, ""},
+		{"whole show", map[int]SkipMarkers{0: {Intro: SkipRange{10, 100}}}, "0:10-100/"},
+		{"sorted by season", map[int]SkipMarkers{
+			2: {Outro: SkipRange{1300, 1400}},
+			1: {Intro: SkipRange{0, 90}, Outro: SkipRange{1290, 1380}},
+		}, "1:0-90/1290-1380;2:/1300-1400"},
+		{"invalid range dropped", map[int]SkipMarkers{1: {Intro: SkipRange{90, 90}}}, "1:/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodeSkipMarkers(tt.markers); got != tt.want {
+				t.Errorf("EncodeSkipMarkers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSkipMarkers(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[int]SkipMarkers
+	}{
+		{"empty", "", map[int]SkipMarkers{}},
+		{"intro and outro", "1:0-90/1290-1380", map[int]SkipMarkers{1: {Intro: SkipRange{0, 90}, Outro: SkipRange{1290, 1380}}}},
+		{"outro only", "2:/1300-1400", map[int]SkipMarkers{2: {Outro: SkipRange{1300, 1400}}}},
+		{"no outro part", "0:10-100", map[int]SkipMarkers{0: {Intro: SkipRange{10, 100}}}},
+		{"malformed entries skipped", "x:1-2;3;4:a-b/5-6", map[int]SkipMarkers{4: {Outro: SkipRange{5, 6}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecodeSkipMarkers(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeSkipMarkers(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipMarkersRoundTrip(t *testing.T) {
+	markers := map[int]SkipMarkers{
+		0: {Intro: SkipRange{5, 95}},
+		1: {Intro: SkipRange{0, 90}, Outro: SkipRange{1290, 1380}},
+		3: {Outro: SkipRange{1200, 1320}},
+	}
+	if got := DecodeSkipMarkers(EncodeSkipMarkers(markers)); !reflect.DeepEqual(got, markers) {
+		t.Errorf("round trip = %v, want %v", got, markers)
+	}
+}
+
+func TestChapterSkipMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		chapters []Chapter
+		want     SkipMarkers
+	}{
+		{"no chapters", nil, SkipMarkers{}},
+		{"opening and ending", []Chapter{
+			{"Prologue", 0}, {"Opening", 90}, {"Part A", 180}, {"Ending", 1290}, {"Preview", 1380},
+		}, SkipMarkers{Intro: SkipRange{90, 180}, Outro: SkipRange{1290, 1380}}},
+		{"short names", []Chapter{{"OP", 0}, {"Episode", 85}, {"ED", 1300}}, SkipMarkers{Intro: SkipRange{0, 85}, Outro: SkipRange{1300, 1420}}},
+		{"credits run to the end", []Chapter{{"Intro", 0}, {"Main", 60}, {"End Credits", 1350}}, SkipMarkers{Intro: SkipRange{0, 60}, Outro: SkipRange{1350, 1420}}},
+		{"first match wins", []Chapter{{"Intro", 0}, {"Intro", 30}, {"Main", 60}}, SkipMarkers{Intro: SkipRange{0, 30}}},
+		{"words inside titles don't match", []Chapter{{"Operation", 0}, {"Edited", 600}}, SkipMarkers{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChapterSkipMarkers(tt.chapters, 1420); got != tt.want {
+				t.Errorf("ChapterSkipMarkers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEpisodeSkipMarkers(t *testing.T) {
+	recorded := map[int]SkipMarkers{
+		0: {Intro: SkipRange{5, 95}, Outro: SkipRange{1300, 1400}},
+		2: {Intro: SkipRange{10, 100}},
+	}
+	chapters := SkipMarkers{Intro: SkipRange{0, 90}}
+
+	tests := []struct {
+		name     string
+		chapters SkipMarkers
+		season   int
+		want     SkipMarkers
+	}{
+		{"chapters first", chapters, 2, SkipMarkers{Intro: SkipRange{0, 90}, Outro: SkipRange{1300, 1400}}},
+		{"season before whole show", SkipMarkers{}, 2, SkipMarkers{Intro: SkipRange{10, 100}, Outro: SkipRange{1300, 1400}}},
+		{"whole show", SkipMarkers{}, 1, recorded[0]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EpisodeSkipMarkers(tt.chapters, recorded, tt.season); got != tt.want {
+				t.Errorf("EpisodeSkipMarkers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if got := EpisodeSkipMarkers(SkipMarkers{}, nil, 1); got != (SkipMarkers{}) {
+		t.Errorf("EpisodeSkipMarkers() without markers = %+v", got)
+	}
+}
+
+func TestSkipRangeContains(t *testing.T) {
+	r := SkipRange{Start: 90, End: 180}
+	tests := []struct {
+		pos  int
+		want bool
+	}{
+		{89, false}, {90, true}, {150, true}, {178, true}, {179, false}, {180, false},
+	}
+	for _, tt := range tests {
+		if got := r.Contains(tt.pos); got != tt.want {
+			t.Errorf("Contains(%d) = %v, want %v", tt.pos, got, tt.want)
+		}
+	}
+	if (SkipRange{}).Contains(0) {
+		t.Error("an empty range contains 0")
+	}
+}
+
+func TestSkipRecorder(t *testing.T) {
+	var recorder SkipRecorder
+	if _, done := recorder.Mark("intro", 95); done {
+		t.Fatal("first press finished a range")
+	}
+	if _, done := recorder.Mark("outro", 1300); done {
+		t.Fatal("first outro press finished a range")
+	}
+	// Pressed at the end first: the range is put in order
+	if r, done := recorder.Mark("intro", 5); !done || r != (SkipRange{5, 95}) {
+		t.Fatalf("intro = %+v, %v", r, done)
+	}
+	if r, done := recorder.Mark("outro", 1390); !done || r != (SkipRange{1300, 1390}) {
+		t.Fatalf("outro = %+v, %v", r, done)
+	}
+
+	var show TVShow
+	SetSkipMarker(&show, 1, "intro", SkipRange{5, 95})
+	SetSkipMarker(&show, 1, "outro", SkipRange{1300, 1390})
+	if show.SkipMarkers[1] != (SkipMarkers{Intro: SkipRange{5, 95}, Outro: SkipRange{1300, 1390}}) {
+		t.Errorf("markers = %+v", show.SkipMarkers)
+	}
+}
@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tracker talks to a Trakt-compatible API. The base URL is configurable, so any service or
+// local stand-in speaking the same endpoints works.
+type Tracker struct {
+	BaseURL      string
+	ClientID     string
+	ClientSecret string
+	TokenFile    string
+	token        TrackerToken
+	client       http.Client
+}
+
+// TrackerToken is the OAuth token stored after logging in
+type TrackerToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// TrackerShow is a search result
+type TrackerShow struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+	IDs   struct {
+		Trakt int    `json:"trakt"`
+		Slug  string `json:"slug"`
+	} `json:"ids"`
+}
+
+// TrackerError is a non-2xx response from the tracker
+type TrackerError struct {
+	Path       string
+	StatusCode int
+}
+
+func (e *TrackerError) Error() string {
+	return fmt.Sprintf("tracker request %s failed with status code %d", e.Path, e.StatusCode)
+}
+
+// Retryable reports whether the request may succeed later, e.g. once the tracker is reachable again
+func (e *TrackerError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusUnauthorized
+}
+
+// NewTracker loads the stored token from tokenFile if there is one
+func NewTracker(baseURL string, clientID string, clientSecret string, tokenFile string) *Tracker {
+	t := &Tracker{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenFile:    tokenFile,
+		client:       http.Client{Timeout: 10 * time.Second},
+	}
+	if data, err := os.ReadFile(tokenFile); err == nil {
+		json.Unmarshal(data, &t.token)
+	}
+	return t
+}
+
+// LoggedIn reports whether a token is stored
+func (t *Tracker) LoggedIn() bool {
+	return t.token.AccessToken != ""
+}
+
+// Login runs the OAuth device flow: prompt shows the user where to enter the code, then the
+// token endpoint is polled until the user has approved octopus
+func (t *Tracker) Login(prompt func(verificationURL string, userCode string)) error {
+	var code struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	if err := t.request(http.MethodPost, "/oauth/device/code", map[string]string{"client_id": t.ClientID}, &code, false); err != nil {
+		return fmt.Errorf("failed to request device code: %w", err)
+	}
+	prompt(code.VerificationURL, code.UserCode)
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		var token TrackerToken
+		err := t.request(http.MethodPost, "/oauth/device/token", map[string]string{
+			"code":          code.DeviceCode,
+			"client_id":     t.ClientID,
+			"client_secret": t.ClientSecret,
+		}, &token, false)
+
+		var trackerErr *TrackerError
+		if errors.As(err, &trackerErr) {
+			switch trackerErr.StatusCode {
+			case http.StatusBadRequest:
+				// Not approved yet
+				continue
+			case http.StatusTooManyRequests:
+				interval += time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get token: %w", err)
+		}
+		return t.saveToken(token)
+	}
+	return fmt.Errorf("device code expired before it was approved")
+}
+
+func (t *Tracker) saveToken(token TrackerToken) error {
+	if token.CreatedAt == 0 {
+		token.CreatedAt = time.Now().Unix()
+	}
+	t.token = token
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(t.TokenFile, data, 0600)
+}
+
+func (t *Tracker) expiresIn() time.Duration {
+	if t.token.ExpiresIn == 0 {
+		return math.MaxInt64
+	}
+	return time.Until(time.Unix(t.token.CreatedAt+t.token.ExpiresIn, 0))
+}
+
+// refresh renews the access token a day before it expires
+func (t *Tracker) refresh() error {
+	if t.token.RefreshToken == "" || t.expiresIn() > 24*time.Hour {
+		return nil
+	}
+
+	var token TrackerToken
+	err := t.request(http.MethodPost, "/oauth/token", map[string]string{
+		"refresh_token": t.token.RefreshToken,
+		"client_id":     t.ClientID,
+		"client_secret": t.ClientSecret,
+		"grant_type":    "refresh_token",
+		"redirect_uri":  "urn:ietf:wg:oauth:2.0:oob",
+	}, &token, false)
+	if err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	return t.saveToken(token)
+}
+
+func (t *Tracker) request(method string, path string, body interface{}, result interface{}, auth bool) error {
+	if auth {
+		if !t.LoggedIn() {
+			return fmt.Errorf("not logged in to the tracker, run octopus -tracker-login")
+		}
+		// A failed refresh only matters once the current token has run out
+		if err := t.refresh(); err != nil && t.expiresIn() <= 0 {
+			return err
+		}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, t.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("trakt-api-version", "2")
+	req.Header.Set("trakt-api-key", t.ClientID)
+	if auth {
+		req.Header.Set("Authorization", "Bearer "+t.token.AccessToken)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("tracker request %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &TrackerError{Path: path, StatusCode: resp.StatusCode}
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode tracker response: %w", err)
+	}
+	return nil
+}
+
+// SearchShows finds shows on the tracker by name
+func (t *Tracker) SearchShows(query string) ([]TrackerShow, error) {
+	var results []struct {
+		Show TrackerShow `json:"show"`
+	}
+	if err := t.request(http.MethodGet, "/search/show?query="+url.QueryEscape(query), nil, &results, false); err != nil {
+		return nil, err
+	}
+
+	shows := make([]TrackerShow, len(results))
+	for i, result := range results {
+		shows[i] = result.Show
+	}
+	return shows, nil
+}
+
+// Scrobble reports playback of an episode, action is "start", "pause" or "stop". Stopping at 80% or more marks it watched.
+func (t *Tracker) Scrobble(action string, trackerID int, season int, number int, progress float64) error {
+	body := map[string]interface{}{
+		"show":     map[string]interface{}{"ids": map[string]int{"trakt": trackerID}},
+		"episode":  map[string]int{"season": season, "number": number},
+		"progress": progress,
+	}
+	err := t.request(http.MethodPost, "/scrobble/"+action, body, nil, true)
+
+	// The same scrobble was already recorded moments ago
+	var trackerErr *TrackerError
+	if errors.As(err, &trackerErr) && trackerErr.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+// ScrobbleItem is a watched episode waiting in the offline queue
+type ScrobbleItem struct {
+	TrackerID int   `json:"tracker_id"`
+	Season    int   `json:"season"`
+	Number    int   `json:"number"`
+	WatchedAt int64 `json:"watched_at"`
+}
+
+// AddToHistory records episodes as watched at the time they were watched
+func (t *Tracker) AddToHistory(items []ScrobbleItem) error {
+	var shows []map[string]interface{}
+	for _, item := range items {
+		shows = append(shows, map[string]interface{}{
+			"ids": map[string]int{"trakt": item.TrackerID},
+			"seasons": []map[string]interface{}{{
+				"number": item.Season,
+				"episodes": []map[string]interface{}{{
+					"number":     item.Number,
+					"watched_at": time.Unix(item.WatchedAt, 0).UTC().Format(time.RFC3339),
+				}},
+			}},
+		})
+	}
+	return t.request(http.MethodPost, "/sync/history", map[string]interface{}{"shows": shows}, nil, true)
+}
+
+// ParseTrackerID returns the numeric ID of a stored mapping, false for unmapped or "none"
+func ParseTrackerID(trackerID string) (int, bool) {
+	id, err := strconv.Atoi(trackerID)
+	return id, err == nil && id > 0
+}
@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// trackerStub stands in for a Trakt-compatible tracker, recording the requests it gets
+type trackerStub struct {
+	mu        sync.Mutex
+	requests  []string
+	bodies    map[string]map[string]interface{}
+	failures  map[string]int // Status code to answer with per path
+	pollsLeft int            // Device token polls answered "not approved yet"
+}
+
+func newTrackerStub(t *testing.T) (*trackerStub, string) {
+	t.Helper()
+	stub := &trackerStub{bodies: make(map[string]map[string]interface{}), failures: make(map[string]int)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server.URL
+}
+
+func (s *trackerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.URL.Path)
+	s.bodies[r.URL.Path] = body
+	if code := s.failures[r.URL.Path]; code != 0 {
+		w.WriteHeader(code)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/oauth/device/code":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "device",
+			"user_code":        "ABCD1234",
+			"verification_url": "https://tracker.test/activate",
+			"expires_in":       30,
+			"interval":         1,
+		})
+	case "/oauth/device/token":
+		if body["code"] != "device" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if s.pollsLeft > 0 {
+			s.pollsLeft--
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(TrackerToken{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 7776000})
+	case "/scrobble/start", "/scrobble/pause", "/scrobble/stop":
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "/sync/history":
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *trackerStub) fail(path string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = code
+}
+
+func (s *trackerStub) seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *trackerStub) body(path string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies[path]
+}
+
+func TestTrackerLogin(t *testing.T) {
+	stub, url := newTrackerStub(t)
+	stub.pollsLeft = 1
+	tokenFile := filepath.Join(t.TempDir(), "tracker_token.json")
+	tracker := NewTracker(url+"/", "client", "secret", tokenFile)
+
+	var prompted string
+	err := tracker.Login(func(verificationURL string, userCode string) {
+		prompted = verificationURL + " " + userCode
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompted != "https://tracker.test/activate ABCD1234" {
+		t.Errorf("prompted %q", prompted)
+	}
+	if !tracker.LoggedIn() {
+		t.Fatal("not logged in after Login")
+	}
+
+	// The token survives a restart and is private to the user
+	info, err := os.Stat(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v", info.Mode().Perm())
+	}
+	if !NewTracker(url, "client", "secret", tokenFile).LoggedIn() {
+		t.Error("stored token not loaded")
+	}
+}
+
+func newTestScrobbler(t *testing.T, url string) *Scrobbler {
+	t.Helper()
+	dir := t.TempDir()
+	tracker := NewTracker(url, "client", "secret", filepath.Join(dir, "tracker_token.json"))
+	tracker.token = TrackerToken{AccessToken: "access"}
+	scrobbler := NewScrobbler(tracker, filepath.Join(dir, "tracker_queue.json"), filepath.Join(dir, "debug.log"))
+	scrobbler.SetMapping("show", "42")
+	return scrobbler
+}
+
+func testEvent(eventType EventType) Event {
+	return Event{Type: eventType, Time: 1700000000, ShowID: "show", Season: 1, Number: 3, Position: 600, Duration: 1200}
+}
+
+func TestScrobblerScrobbles(t *testing.T) {
+	tests := []struct {
+		event    EventType
+		path     string
+		progress float64
+	}{
+		{EventEpisodeStart, "/scrobble/start", 50},
+		{EventPaused, "/scrobble/pause", 50},
+		{EventResumed, "/scrobble/start", 50},
+		{EventEpisodeStopped, "/scrobble/stop", 50},
+		{EventEpisodeCompleted, "/scrobble/stop", 100},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.event), func(t *testing.T) {
+			stub, url := newTrackerStub(t)
+			scrobbler := newTestScrobbler(t, url)
+			scrobbler.Handle(testEvent(tt.event))
+			scrobbler.Wait()
+
+			if seen := stub.seen(); len(seen) != 1 || seen[0] != tt.path {
+				t.Fatalf("requests = %v, want [%s]", seen, tt.path)
+			}
+			body := stub.body(tt.path)
+			if body["progress"] != tt.progress {
+				t.Errorf("progress = %v, want %v", body["progress"], tt.progress)
+			}
+			episode, _ := body["episode"].(map[string]interface{})
+			if episode["season"] != 1.0 || episode["number"] != 3.0 {
+				t.Errorf("episode = %v", episode)
+			}
+		})
+	}
+
+	// Unmapped shows aren't scrobbled
+	stub, url := newTrackerStub(t)
+	scrobbler := newTestScrobbler(t, url)
+	event := testEvent(EventEpisodeStart)
+	event.ShowID = "other"
+	scrobbler.Handle(event)
+	scrobbler.Wait()
+	if seen := stub.seen(); len(seen) != 0 {
+		t.Errorf("requests for an unmapped show: %v", seen)
+	}
+}
+
+func TestScrobblerQueuesAndRetries(t *testing.T) {
+	stub, url := newTrackerStub(t)
+	scrobbler := newTestScrobbler(t, url)
+
+	// The tracker is down when the episode is watched, so it waits in the queue
+	stub.fail("/scrobble/stop", http.StatusServiceUnavailable)
+	scrobbler.Handle(testEvent(EventEpisodeCompleted))
+	scrobbler.Wait()
+	data, err := os.ReadFile(scrobbler.QueueFile)
+	if err != nil {
+		t.Fatalf("nothing queued: %v", err)
+	}
+	var queued []ScrobbleItem
+	if err := json.Unmarshal(data, &queued); err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0] != (ScrobbleItem{TrackerID: 42, Season: 1, Number: 3, WatchedAt: 1700000000}) {
+		t.Fatalf("queued %+v", queued)
+	}
+
+	// A rejected scrobble isn't queued
+	stub.fail("/scrobble/stop", http.StatusNotFound)
+	next := testEvent(EventEpisodeCompleted)
+	next.Number = 4
+	scrobbler.Handle(next)
+	scrobbler.Wait()
+	data, _ = os.ReadFile(scrobbler.QueueFile)
+	json.Unmarshal(data, &queued)
+	if len(queued) != 1 {
+		t.Fatalf("queue after a rejected scrobble = %+v", queued)
+	}
+
+	// The next scrobble that gets through sends the queue along
+	scrobbler.Handle(testEvent(EventEpisodeStart))
+	scrobbler.Wait()
+	seen := stub.seen()
+	if seen[len(seen)-1] != "/sync/history" {
+		t.Fatalf("requests = %v, want the queue sent last", seen)
+	}
+	if !strings.Contains(mustJSON(t, stub.body("/sync/history")), `"watched_at":"2023-11-14T22:13:20Z"`) {
+		t.Errorf("history body = %v", stub.body("/sync/history"))
+	}
+	if _, err := os.Stat(scrobbler.QueueFile); !os.IsNotExist(err) {
+		t.Errorf("queue file left after sending: %v", err)
+	}
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
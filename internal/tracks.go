@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Track is an audio or subtitle entry of mpv's track-list property
+type Track struct {
+	ID       int
+	Type     string // "audio", "sub" or "video"
+	Lang     string
+	Title    string
+	Selected bool
+}
+
+// noTrack is how a remembered "subtitles off" choice is stored
+const noTrack = "none"
+
+// GetMPVTracks returns the tracks of the file currently loaded in mpv
+func GetMPVTracks(ipcSocketPath string) ([]Track, error) {
+	data, err := MPVSendCommand(ipcSocketPath, []interface{}{"get_property", "track-list"})
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	list, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected track-list format")
+	}
+
+	var tracks []Track
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := entry["id"].(float64)
+		track := Track{ID: int(id)}
+		track.Type, _ = entry["type"].(string)
+		track.Lang, _ = entry["lang"].(string)
+		track.Title, _ = entry["title"].(string)
+		track.Selected, _ = entry["selected"].(bool)
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// GetMPVTrackID returns the selected track id for kind ("audio" or "sub"), 0 when disabled
+func GetMPVTrackID(ipcSocketPath string, kind string) (int, error) {
+	data, err := MPVSendCommand(ipcSocketPath, []interface{}{"get_property", trackProperty(kind)})
+	if err != nil {
+		return 0, err
+	}
+	id, _ := data.(float64)
+	return int(id), nil
+}
+
+// SetMPVTrack selects a track by id for kind ("audio" or "sub"), 0 disables it
+func SetMPVTrack(ipcSocketPath string, kind string, id int) error {
+	var value interface{} = id
+	if id == 0 {
+		value = "no"
+	}
+	_, err := MPVSendCommand(ipcSocketPath, []interface{}{"set_property", trackProperty(kind), value})
+	return err
+}
+
+func trackProperty(kind string) string {
+	if kind == "sub" {
+		return "sid"
+	}
+	return "aid"
+}
+
+// RememberTrack describes the track of kind with the given id so it can be found again in other
+// episodes. mpv numbers each kind separately, so the same id can belong to a video, audio and sub track.
+func RememberTrack(tracks []Track, kind string, id int) string {
+	if id == 0 {
+		return noTrack
+	}
+	for _, track := range tracks {
+		if track.Type == kind && track.ID == id {
+			return track.Lang + "|" + track.Title
+		}
+	}
+	return ""
+}
+
+// SelectTrack picks the track id for kind, preferring the remembered track and then the
+// comma-separated preference list, where each entry matches a language code or part of a title
+func SelectTrack(tracks []Track, kind string, remembered string, preference string) (int, bool) {
+	var candidates []Track
+	for _, track := range tracks {
+		if track.Type == kind {
+			candidates = append(candidates, track)
+		}
+	}
+
+	if remembered == noTrack {
+		return 0, true
+	}
+	if remembered != "" {
+		lang, title, _ := strings.Cut(remembered, "|")
+		for _, track := range candidates {
+			if strings.EqualFold(track.Lang, lang) && track.Title == title {
+				return track.ID, true
+			}
+		}
+		for _, track := range candidates {
+			if lang != "" && strings.EqualFold(track.Lang, lang) {
+				return track.ID, true
+			}
+		}
+	}
+
+	for _, token := range strings.Split(preference, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+		if token == noTrack {
+			return 0, true
+		}
+		for _, track := range candidates {
+			if strings.ToLower(track.Lang) == token || strings.Contains(strings.ToLower(track.Title), token) {
+				return track.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ApplyTrackPreferences selects the show's remembered or preferred tracks and returns the selected ids by kind
+func ApplyTrackPreferences(ipcSocketPath string, show *TVShow, config *OctoConfig) (map[string]int, error) {
+	selected := make(map[string]int)
+	tracks, err := GetMPVTracks(ipcSocketPath)
+	if err != nil {
+		return selected, err
+	}
+
+	for _, kind := range []string{"audio", "sub"} {
+		remembered, preference := show.AudioTrack, config.AudioPreference
+		if kind == "sub" {
+			remembered, preference = show.SubtitleTrack, config.SubtitlePreference
+		}
+
+		id, ok := SelectTrack(tracks, kind, remembered, preference)
+		if !ok {
+			continue
+		}
+		if err := SetMPVTrack(ipcSocketPath, kind, id); err != nil {
+			return selected, err
+		}
+		selected[kind] = id
+	}
+	return selected, nil
+}
+
+// RememberTrackChanges stores on the show any track the viewer switched to since the last call
+func RememberTrackChanges(ipcSocketPath string, show *TVShow, selected map[string]int) error {
+	var tracks []Track
+	for _, kind := range []string{"audio", "sub"} {
+		id, err := GetMPVTrackID(ipcSocketPath, kind)
+		if err != nil {
+			return err
+		}
+		previous, known := selected[kind]
+		selected[kind] = id
+		if !known || previous == id {
+			continue
+		}
+
+		// Tracks can be added during playback (e.g. external subtitles), so look them up fresh
+		if tracks == nil {
+			if tracks, err = GetMPVTracks(ipcSocketPath); err != nil {
+				return err
+			}
+		}
+		remembered := RememberTrack(tracks, kind, id)
+		if remembered == "" {
+			continue
+		}
+		if kind == "sub" {
+			show.SubtitleTrack = remembered
+		} else {
+			show.AudioTrack = remembered
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package internal
+
+import "testing"
+
+func TestSelectTrack(t *testing.T) {
+	tracks := []Track{
+		{ID: 1, Type: "video"},
+		{ID: 1, Type: "audio", Lang: "jpn", Title: "Japanese"},
+		{ID: 2, Type: "audio", Lang: "eng", Title: "English 5.1"},
+		{ID: 3, Type: "audio", Lang: "eng", Title: "Commentary"},
+		{ID: 1, Type: "sub", Lang: "eng", Title: "Signs & Songs"},
+		{ID: 2, Type: "sub", Lang: "eng", Title: "Full Subtitles"},
+		{ID: 3, Type: "sub", Lang: "ger", Title: ""},
+	}
+
+	tests := []struct {
+		name       string
+		kind       string
+		remembered string
+		preference string
+		wantID     int
+		wantOK     bool
+	}{
+		{"nothing to go by", "audio", "", "", 0, false},
+		{"remembered track", "audio", "eng|Commentary", "jpn", 3, true},
+		{"remembered language when the title is gone", "audio", "eng|Director's cut", "jpn", 2, true},
+		{"remembered language missing falls back to preference", "audio", "fre|French", "jpn", 1, true},
+		{"remembered off", "sub", noTrack, "eng", 0, true},
+		{"first preference present", "audio", "", "jpn,eng", 1, true},
+		{"later preference when the first is missing", "audio", "", "fre, eng", 2, true},
+		{"language codes ignore case", "audio", "", "ENG", 2, true},
+		{"title match", "sub", "", "full", 2, true},
+		{"preference off", "sub", "", "none,eng", 0, true},
+		{"no preference matches", "sub", "", "spa,ita", 0, false},
+		{"only tracks of the kind", "sub", "", "jpn", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := SelectTrack(tracks, tt.kind, tt.remembered, tt.preference)
+			if id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("SelectTrack(%q, %q, %q) = %d, %v, want %d, %v", tt.kind, tt.remembered, tt.preference, id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRememberTrack(t *testing.T) {
+	// mpv numbers video, audio and sub tracks separately
+	tracks := []Track{
+		{ID: 1, Type: "video"},
+		{ID: 1, Type: "audio", Lang: "jpn", Title: "Japanese"},
+		{ID: 2, Type: "audio", Lang: "eng", Title: "English 5.1"},
+		{ID: 1, Type: "sub", Lang: "eng", Title: "Signs & Songs"},
+		{ID: 2, Type: "sub", Lang: "eng", Title: "Full Subtitles"},
+	}
+	tests := []struct {
+		kind string
+		id   int
+		want string
+	}{
+		{"sub", 0, noTrack},
+		{"audio", 1, "jpn|Japanese"},
+		{"audio", 2, "eng|English 5.1"},
+		{"sub", 1, "eng|Signs & Songs"},
+		{"sub", 2, "eng|Full Subtitles"},
+		{"sub", 7, ""},
+	}
+	for _, tt := range tests {
+		if got := RememberTrack(tracks, tt.kind, tt.id); got != tt.want {
+			t.Errorf("RememberTrack(%s %d) = %q, want %q", tt.kind, tt.id, got, tt.want)
+		}
+	}
+}
@@ -13,8 +13,11 @@ import (
 
 
 
+// vadapavAPI is where directories are listed, tests point it at a local server
+var vadapavAPI = "https://dl2.vadapav.mov/api/d/"
+
 func GetVadapav(id string) (*Directory, error) {
-	url := "https://dl2.vadapav.mov/api/d/" + id
+	url := vadapavAPI + id
 
 	resp, err := http.Get(url)
 	if err != nil {
@@ -205,3 +208,70 @@ func GetNextEpisode(currentShow *Show, currentEpisodeID string) *EpisodeEntry {
 
 	return nil
 }
+
+// NextUnwatchedEpisode is the first episode after currentEpisodeID that isn't marked watched in
+// states, or simply the next one when every later episode has been watched
+func NextUnwatchedEpisode(currentShow *Show, currentEpisodeID string, states map[string]EpisodeState) *EpisodeEntry {
+	next := GetNextEpisode(currentShow, currentEpisodeID)
+	for episode := next; episode != nil; episode = GetNextEpisode(currentShow, episode.ID) {
+		if !states[episode.ID].Watched {
+			return episode
+		}
+	}
+	return next
+}
+
+// AutoAdvanceEpisode returns the episode auto-advance continues with, the next unwatched one
+// with skipWatched or else simply the next one
+func AutoAdvanceEpisode(currentShow *Show, currentEpisodeID string, states map[string]EpisodeState, skipWatched bool) *EpisodeEntry {
+	if currentShow == nil {
+		return nil
+	}
+	if !skipWatched {
+		return GetNextEpisode(currentShow, currentEpisodeID)
+	}
+	return NextUnwatchedEpisode(currentShow, currentEpisodeID, states)
+}
+
+func GetPreviousEpisode(currentShow *Show, currentEpisodeID string) *EpisodeEntry {
+	for i, episode := range currentShow.EpisodesList {
+		if episode.ID == currentEpisodeID && i > 0 {
+			return &currentShow.EpisodesList[i-1]
+		}
+	}
+
+	return nil
+}
+
+// FindEpisode returns the episode with the given ID, or nil if the show doesn't list it
+func FindEpisode(currentShow *Show, episodeID string) *EpisodeEntry {
+	if currentShow == nil {
+		return nil
+	}
+	for i, episode := range currentShow.EpisodesList {
+		if episode.ID == episodeID {
+			return &currentShow.EpisodesList[i]
+		}
+	}
+	return nil
+}
+
+// EpisodeTitle formats the show name and SxxExx of an episode for display
+func EpisodeTitle(currentShow *Show, episodeID string) string {
+	if currentShow == nil {
+		return episodeID
+	}
+	if code := EpisodeCode(currentShow, episodeID); code != "" {
+		return currentShow.Name + " - " + code
+	}
+	return currentShow.Name
+}
+
+// EpisodeCode formats an episode as SxxExx, empty if it isn't part of the show
+func EpisodeCode(currentShow *Show, episodeID string) string {
+	episode := FindEpisode(currentShow, episodeID)
+	if episode == nil {
+		return ""
+	}
+	return fmt.Sprintf("S%02dE%02d", episode.Season, episode.Episode)
+}
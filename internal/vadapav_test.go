@@ -0,0 +1,49 @@
+package internal
+
+import "testing"
+
+func TestAutoAdvanceEpisode(t *testing.T) {
+	show := &Show{Name: "Show", EpisodesList: []EpisodeEntry{
+		{ID: "e1", Episode: 1}, {ID: "e2", Episode: 2}, {ID: "e3", Episode: 3}, {ID: "e4", Episode: 4},
+	}}
+	states := map[string]EpisodeState{
+		"e2": {EpisodeID: "e2", Watched: true},
+		"e3": {EpisodeID: "e3", Position: 300},
+		"e4": {EpisodeID: "e4", Watched: true},
+	}
+	allWatched := map[string]EpisodeState{
+		"e2": {EpisodeID: "e2", Watched: true},
+		"e3": {EpisodeID: "e3", Watched: true},
+		"e4": {EpisodeID: "e4", Watched: true},
+	}
+
+	tests := []struct {
+		name        string
+		show        *Show
+		current     string
+		states      map[string]EpisodeState
+		skipWatched bool
+		want        string
+	}{
+		{"next in order", show, "e1", states, false, "e2"},
+		{"skips watched", show, "e1", states, true, "e3"},
+		{"started counts as unwatched", show, "e2", states, true, "e3"},
+		{"next unwatched is the next", show, "e2", nil, true, "e3"},
+		{"everything watched plays the next", show, "e1", allWatched, true, "e2"},
+		{"watched ones at the end", show, "e3", states, true, "e4"},
+		{"last episode", show, "e4", states, true, ""},
+		{"unknown episode", show, "e9", states, true, ""},
+		{"no show details", nil, "e1", states, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if episode := AutoAdvanceEpisode(tt.show, tt.current, tt.states, tt.skipWatched); episode != nil {
+				got = episode.ID
+			}
+			if got != tt.want {
+				t.Errorf("AutoAdvanceEpisode(%s) = %q, want %q", tt.current, got, tt.want)
+			}
+		})
+	}
+}